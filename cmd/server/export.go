@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/export"
+	"throwback-chat/internal/models"
+)
+
+// runExport implements the "export" subcommand and returns the exit code
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "text", "Output format: text, jsonl or html")
+	from := flags.String("from", "", "Start of the range, YYYY-MM-DD or RFC 3339 (default: beginning)")
+	to := flags.String("to", "", "End of the range, YYYY-MM-DD (inclusive) or RFC 3339 (default: now)")
+	tz := flags.String("tz", "UTC", "Time zone for timestamps and dates")
+	output := flags.String("o", "", "Output file (default: standard output)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server export [flags] CHANNEL")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	location, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unknown time zone %q\n", *tz)
+		return 2
+	}
+	fromTime, err := export.ParseTime(*from, location, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	toTime, err := export.ParseTime(*to, location, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	dbPath := getEnv("TBCHAT_DB", "chat.db")
+	database, err := db.New(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	channel, err := models.GetChannelByName(database, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to look up channel: %v\n", err)
+		return 1
+	}
+	if channel == nil {
+		fmt.Fprintf(os.Stderr, "Channel not found: %s\n", flags.Arg(0))
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	err = export.Write(w, database, export.Options{
+		Channel:  channel,
+		Format:   format,
+		From:     fromTime,
+		To:       toTime,
+		Location: location,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/irclog"
+)
+
+// logFileDate finds the day in names like "2026-10-18.log" or
+// "#ops_20261018.log", which is how ZNC names its logs
+var logFileDate = regexp.MustCompile(`(\d{4})-?(\d{2})-?(\d{2})`)
+
+// runImport implements the "import" subcommand and returns the exit code
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := flags.String("format", "", "Log format: irssi, weechat or znc")
+	channelName := flags.String("channel", "", "Channel to import into, created if needed")
+	tz := flags.String("tz", "UTC", "Time zone the logs were written in")
+	date := flags.String("date", "", "Day of the log, YYYY-MM-DD (default: taken from the file name for znc)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server import -format FORMAT -channel CHANNEL [flags] FILE...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *formatName == "" || *channelName == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	format, err := irclog.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	location, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unknown time zone %q\n", *tz)
+		return 2
+	}
+	var day time.Time
+	if *date != "" {
+		if day, err = time.ParseInLocation(time.DateOnly, *date, location); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid date %q, expected YYYY-MM-DD\n", *date)
+			return 2
+		}
+	}
+
+	dbPath := getEnv("TBCHAT_DB", "chat.db")
+	database, err := db.New(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	importer, err := irclog.NewImporter(database, *channelName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to prepare import: %v\n", err)
+		return 1
+	}
+
+	var total irclog.Stats
+	for _, path := range flags.Args() {
+		opts := irclog.ParseOptions{Location: location, Date: day}
+		if opts.Date.IsZero() {
+			opts.Date = dateFromFileName(path, location)
+		}
+
+		stats, err := importFile(importer, path, format, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		fmt.Printf("%s: %d new of %d messages, %d lines skipped\n", path, stats.Imported, stats.Entries, stats.Skipped)
+
+		total.Entries += stats.Entries
+		total.Imported += stats.Imported
+		total.Skipped += stats.Skipped
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Printf("Total: %d new of %d messages, %d lines skipped\n", total.Imported, total.Entries, total.Skipped)
+	}
+	return 0
+}
+
+func importFile(importer *irclog.Importer, path string, format irclog.Format, opts irclog.ParseOptions) (irclog.Stats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return irclog.Stats{}, err
+	}
+	defer file.Close()
+
+	return importer.Import(file, format, opts)
+}
+
+func dateFromFileName(path string, location *time.Location) time.Time {
+	match := logFileDate.FindStringSubmatch(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if match == nil {
+		return time.Time{}
+	}
+	day, err := time.ParseInLocation("20060102", match[1]+match[2]+match[3], location)
+	if err != nil {
+		return time.Time{}
+	}
+	return day
+}
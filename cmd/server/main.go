@@ -1,52 +1,276 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"throwback-chat/internal/attachments"
+	"throwback-chat/internal/certs"
 	"throwback-chat/internal/db"
+	"throwback-chat/internal/logging"
+	"throwback-chat/internal/netguard"
 	"throwback-chat/internal/web"
+	webclient "throwback-chat/web"
 )
 
+// certWatchInterval is how often the TLS certificate files are checked for
+// changes
+const certWatchInterval = 30 * time.Second
+
+// defaultUploadTypes are the content types that can be uploaded unless
+// TBCHAT_UPLOAD_TYPES says otherwise. Types are detected from the content.
+const defaultUploadTypes = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"
+
 func main() {
 	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	envErr := godotenv.Load()
+
+	// Set up logging before anything else writes to the log
+	redact, _ := strconv.ParseBool(os.Getenv("TBCHAT_LOG_REDACT"))
+	if _, err := logging.Setup(os.Stderr, logging.Config{
+		Format:        os.Getenv("TBCHAT_LOG_FORMAT"),
+		Level:         os.Getenv("TBCHAT_LOG_LEVEL"),
+		RedactContent: redact,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	if envErr != nil {
+		slog.Debug("No .env file found")
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			// Explicit form of the default command
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "help", "-h", "--help":
+			printUsage()
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
+			printUsage()
+			os.Exit(2)
+		}
 	}
 
+	runServer()
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `Usage: server [command]
+
+Commands:
+  serve                 Run the chat server (default)
+  migrate status        Show applied and pending migrations
+  migrate up            Apply all pending migrations
+  migrate down-to NAME  Revert migrations applied after NAME ("0" reverts all)
+  export CHANNEL        Write a channel log (see "server export -h")
+  import FILE...        Import irssi, weechat or ZNC logs (see "server import -h")`)
+}
+
+// getEnv returns the value of an environment variable or a default
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// splitList splits a comma separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func runServer() {
 	// Get configuration from environment
-	port := os.Getenv("TBCHAT_PORT")
-	if port == "" {
-		port = "8080"
+	port := getEnv("TBCHAT_PORT", "8080")
+	host := getEnv("TBCHAT_HOST", "0.0.0.0")
+	dbPath := getEnv("TBCHAT_DB", "chat.db")
+
+	webhookRate, err := strconv.Atoi(getEnv("TBCHAT_WEBHOOK_RATE", "30"))
+	if err != nil || webhookRate < 0 {
+		slog.Error("Invalid TBCHAT_WEBHOOK_RATE", "value", os.Getenv("TBCHAT_WEBHOOK_RATE"))
+		os.Exit(2)
 	}
 
-	host := os.Getenv("TBCHAT_HOST")
-	if host == "" {
-		host = "0.0.0.0"
+	webhookAllowedNets, err := netguard.ParsePrefixes(splitList(os.Getenv("TBCHAT_WEBHOOK_ALLOW_NETS")))
+	if err != nil {
+		slog.Error("Invalid TBCHAT_WEBHOOK_ALLOW_NETS", "value", os.Getenv("TBCHAT_WEBHOOK_ALLOW_NETS"), "error", err)
+		os.Exit(2)
 	}
 
-	dbPath := os.Getenv("TBCHAT_DB")
-	if dbPath == "" {
-		dbPath = "chat.db"
+	// TLS is on when both a certificate and a key are configured
+	tlsCfg := tlsSettings{
+		certFile: os.Getenv("TBCHAT_TLS_CERT"),
+		keyFile:  os.Getenv("TBCHAT_TLS_KEY"),
+		httpPort: os.Getenv("TBCHAT_HTTP_PORT"),
+		httpMode: getEnv("TBCHAT_HTTP_MODE", web.HTTPModeRedirect),
+	}
+	if (tlsCfg.certFile == "") != (tlsCfg.keyFile == "") {
+		slog.Error("TBCHAT_TLS_CERT and TBCHAT_TLS_KEY must be set together")
+		os.Exit(2)
+	}
+	if tlsCfg.httpMode != web.HTTPModeRedirect && tlsCfg.httpMode != web.HTTPModeRefuse {
+		slog.Error("Invalid TBCHAT_HTTP_MODE, must be redirect or refuse", "value", tlsCfg.httpMode)
+		os.Exit(2)
 	}
 
 	// Initialize database
 	database, err := db.New(dbPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
 	}
 	defer database.Close()
 
+	// Serve the web client from disk during development, otherwise the
+	// embedded build if there is one
+	webFS := webclient.Dist()
+	if webDir := os.Getenv("TBCHAT_WEB_DIR"); webDir != "" {
+		webFS = os.DirFS(webDir)
+	}
+	if webFS == nil {
+		slog.Info("Web client not embedded, serving the API only")
+	}
+
+	// Uploads are stored on disk when a directory is configured
+	var attachmentStore *attachments.Store
+	if uploadDir := os.Getenv("TBCHAT_UPLOAD_DIR"); uploadDir != "" {
+		attachmentStore, err = attachments.NewStore(uploadDir)
+		if err != nil {
+			slog.Error("Failed to create upload directory", "dir", uploadDir, "error", err)
+			os.Exit(1)
+		}
+	}
+	uploadMaxMB, err := strconv.Atoi(getEnv("TBCHAT_UPLOAD_MAX_MB", "10"))
+	if err != nil || uploadMaxMB <= 0 {
+		slog.Error("Invalid TBCHAT_UPLOAD_MAX_MB", "value", os.Getenv("TBCHAT_UPLOAD_MAX_MB"))
+		os.Exit(2)
+	}
+
+	linkPreviews, err := strconv.ParseBool(getEnv("TBCHAT_LINK_PREVIEWS", "true"))
+	if err != nil {
+		slog.Error("Invalid TBCHAT_LINK_PREVIEWS", "value", os.Getenv("TBCHAT_LINK_PREVIEWS"))
+		os.Exit(2)
+	}
+
+	// Clients see this name in the hello response
+	serverName := os.Getenv("TBCHAT_SERVER_NAME")
+	if serverName == "" {
+		serverName, _ = os.Hostname()
+	}
+
 	// Initialize web server
-	server := web.NewServer(database, dbPath)
+	server := web.NewServer(database, web.Config{
+		DBPath:     dbPath,
+		AdminToken: os.Getenv("TBCHAT_ADMIN_TOKEN"),
+		APITokens:  splitList(os.Getenv("TBCHAT_API_TOKENS")),
+
+		WebhookNickname:  getEnv("TBCHAT_WEBHOOK_NICK", "Webhook"),
+		WebhookRateLimit: webhookRate,
+
+		WebhookAllowedNets: webhookAllowedNets,
+
+		WebFS: webFS,
+
+		ServerName: serverName,
+
+		Attachments:       attachmentStore,
+		AttachmentMaxSize: int64(uploadMaxMB) << 20,
+		AttachmentTypes:   splitList(getEnv("TBCHAT_UPLOAD_TYPES", defaultUploadTypes)),
+
+		LinkPreviews: linkPreviews,
+	})
 	router := server.SetupRouter()
 
-	log.Printf("Starting server on %s:%s", host, port)
-	log.Printf("Using database: %s", dbPath)
+	if tlsCfg.certFile != "" {
+		serveTLS(router, host, port, dbPath, tlsCfg)
+		return
+	}
+	if tlsCfg.httpPort != "" {
+		slog.Warn("TBCHAT_HTTP_PORT is ignored without TBCHAT_TLS_CERT and TBCHAT_TLS_KEY")
+	}
+
+	slog.Info("Starting server", "addr", host+":"+port, "db", dbPath)
 
 	if err := http.ListenAndServe(host+":"+port, router); err != nil {
-		log.Fatal(err)
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// tlsSettings configures the server to terminate TLS itself
+type tlsSettings struct {
+	certFile string
+	keyFile  string
+	httpPort string // plain HTTP port, none if empty
+	httpMode string // what the plain HTTP port does, see web.PlainHTTPHandler
+}
+
+// serveTLS runs the server over HTTPS with a certificate that is reloaded on
+// SIGHUP and whenever its files change
+func serveTLS(router http.Handler, host, port, dbPath string, cfg tlsSettings) {
+	reloader, err := certs.NewReloader(cfg.certFile, cfg.keyFile)
+	if err != nil {
+		slog.Error("Failed to load TLS certificate", "error", err)
+		os.Exit(1)
+	}
+
+	go reloader.Watch(context.Background(), certWatchInterval)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			slog.Info("Reloading TLS certificate on SIGHUP")
+			if err := reloader.Reload(); err != nil {
+				slog.Error("Failed to reload TLS certificate, keeping the current one", "error", err)
+			}
+		}
+	}()
+
+	if cfg.httpPort != "" {
+		go func() {
+			slog.Info("Starting plain HTTP listener", "addr", host+":"+cfg.httpPort, "mode", cfg.httpMode)
+			if err := http.ListenAndServe(host+":"+cfg.httpPort, web.PlainHTTPHandler(cfg.httpMode, port)); err != nil {
+				slog.Error("Plain HTTP listener stopped", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	server := &http.Server{
+		Addr:      host + ":" + port,
+		Handler:   router,
+		TLSConfig: reloader.TLSConfig(),
+	}
+
+	slog.Info("Starting server", "addr", server.Addr, "db", dbPath, "tls", true)
+
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// runMigrate implements the "migrate" subcommand and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return 2
+	}
+
+	dbPath := getEnv("TBCHAT_DB", "chat.db")
+	database, err := db.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "status":
+		err = printMigrationStatus(database)
+	case "up":
+		err = database.RunMigrations()
+	case "down-to":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: server migrate down-to NAME")
+			return 2
+		}
+		err = database.MigrateDownTo(args[1])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command: %s\n\n", args[0])
+		printUsage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(database *db.DB) error {
+	states, err := database.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATE\tAPPLIED AT\tREVERSIBLE")
+	for _, state := range states {
+		status := "pending"
+		switch {
+		case state.Missing:
+			status = "applied (missing)"
+		case state.Modified:
+			status = "applied (modified)"
+		case state.Applied:
+			status = "applied"
+		}
+
+		appliedAt := "-"
+		if state.AppliedAt != nil {
+			appliedAt = state.AppliedAt.Format(time.DateTime)
+		}
+
+		reversible := "no"
+		if state.Reversible {
+			reversible = "yes"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", state.Name, status, appliedAt, reversible)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,122 @@
+// Package attachments stores uploaded files on local disk. Files are named by
+// the SHA-256 of their content, so uploading the same file twice stores it
+// once; which uploads refer to a file is kept in the database.
+package attachments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrTooLarge is returned by Put for content over the size limit
+var ErrTooLarge = errors.New("attachment is too large")
+
+// pruneGrace keeps Prune away from files that were just stored, whose
+// uploads may not be recorded in the database yet
+const pruneGrace = time.Hour
+
+// Store keeps files in a directory, fanned out by the first two characters
+// of their hash
+type Store struct {
+	dir string
+}
+
+// NewStore creates the directory if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Put stores the content of r, which must not be larger than maxSize bytes,
+// and returns its hex encoded SHA-256 and size
+func (s *Store) Put(r io.Reader, maxSize int64) (string, int64, error) {
+	tmp, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return "", 0, err
+	}
+	if size > maxSize {
+		return "", 0, ErrTooLarge
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	target := s.path(sum)
+
+	// A file with the same content is kept, touching it keeps Prune away
+	now := time.Now()
+	if err := os.Chtimes(target, now, now); err == nil {
+		return sum, size, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, err
+	}
+	return sum, size, nil
+}
+
+// Open opens a stored file
+func (s *Store) Open(hash string) (*os.File, error) {
+	if len(hash) != sha256.Size*2 {
+		return nil, fs.ErrNotExist
+	}
+	return os.Open(s.path(hash))
+}
+
+// Prune removes the files referenced reports false for, except those stored
+// within the last hour. It returns how many were removed.
+func (s *Store) Prune(referenced func(hash string) bool) (int, error) {
+	removed := 0
+	cutoff := time.Now().Add(-pruneGrace)
+
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Only files in the fan-out directories are stored files, temporary
+		// ones at the top belong to uploads in progress
+		if entry.IsDir() || filepath.Dir(filepath.Dir(path)) != filepath.Clean(s.dir) {
+			return nil
+		}
+		if referenced(entry.Name()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Error("Failed to remove attachment file", "path", path, "error", err)
+			return nil
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,132 @@
+// Package certs keeps the server's TLS certificate up to date while it runs.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"throwback-chat/internal/metrics"
+)
+
+// Reloader holds a certificate loaded from a cert and key file. Handshakes
+// take whatever certificate is current, so reloading affects new connections
+// only and open ones, including WebSockets, carry on.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time // latest modification time of the two files when loaded
+}
+
+// NewReloader loads the certificate and fails if it can't be used
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if err := metrics.Registry.Register(metrics.TLSCertificateExpiry); err != nil {
+		slog.Error("Failed to register TLS certificate metric", "error", err)
+	}
+	return r, nil
+}
+
+// Reload loads the files again. A broken pair leaves the current certificate
+// in place, so a half finished renewal doesn't take the server down.
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	metrics.TLSCertificateExpiry.Set(float64(leaf.NotAfter.Unix()))
+	slog.Info("Loaded TLS certificate", "subject", leaf.Subject.String(), "dns_names", leaf.DNSNames,
+		"not_after", leaf.NotAfter)
+	return nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server configuration that uses the reloader
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Watch reloads the certificate whenever either file changes, checking
+// every interval until ctx is done. Renewal tools replace both files, so a
+// reload that fails because only one of them was written is retried on the
+// next check.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.latestModTime()
+		if err != nil {
+			slog.Warn("Failed to check TLS certificate files", "error", err)
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			slog.Error("Failed to reload changed TLS certificate, keeping the current one", "error", err)
+		}
+	}
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"slices"
+	"sort"
+)
+
+// ProtocolVersion is the version of the WebSocket protocol the server speaks.
+// Clients that never send hello get this version without any capabilities.
+const ProtocolVersion = 1
+
+// Capabilities a client can ask for with hello. Each one adds fields or
+// messages that older clients do not expect, so they are only sent to
+// sessions that enabled them.
+const (
+	CapMessageIDs  = "message-ids"   // messages and events carry their ID
+	CapServerTime  = "server-time"   // responses carry the server's time
+	CapEchoMessage = "echo-message"  // the sender's copy of a message carries its req_id
+	CapBatch       = "batch"         // join playback is wrapped in batch start and end messages
+	CapTyping      = "typing"        // typing notices of other members are relayed
+	CapThreads     = "threads"       // thread replies are sent live and get_thread can be used
+	CapReactions   = "reactions"     // messages carry their reactions and reaction changes are relayed
+	CapAttachments = "attachments"   // messages carry their attachments
+	CapPreviews    = "link-previews" // messages carry link previews and previews fetched later are relayed
+	CapRendered    = "rendered-text" // messages carry their html and plain renderings
+	CapEventDetail = "event-details" // events carry reasons, actors, nicknames and announcement text
+	CapMentions    = "mentions"      // mentions of the user are pushed to all of their sessions
+	CapPins        = "pins"          // pin changes are relayed and join responses carry the pins
+	CapReadMarkers = "read-markers"  // read markers moved by the user's other sessions are relayed
+)
+
+// SupportedCapabilities lists the capabilities the server implements
+var SupportedCapabilities = []string{
+	CapAttachments,
+	CapBatch,
+	CapEchoMessage,
+	CapEventDetail,
+	CapPreviews,
+	CapMentions,
+	CapMessageIDs,
+	CapPins,
+	CapReactions,
+	CapReadMarkers,
+	CapRendered,
+	CapServerTime,
+	CapThreads,
+	CapTyping,
+}
+
+// Negotiated is implemented by messages whose shape depends on the
+// capabilities of the receiving session. SendMessage sends what ForSession
+// returns, so one broadcast can reach old and new clients alike. Returning
+// nil skips the session.
+type Negotiated interface {
+	ForSession(s *Session) interface{}
+}
+
+// SetCapabilities enables the supported capabilities among requested,
+// replacing those enabled before, and returns the enabled ones sorted
+func (s *Session) SetCapabilities(requested []string) []string {
+	enabled := make(map[string]bool)
+	for _, name := range requested {
+		if slices.Contains(SupportedCapabilities, name) {
+			enabled[name] = true
+		}
+	}
+
+	s.mu.Lock()
+	s.caps = enabled
+	s.mu.Unlock()
+
+	return sortedCapabilities(enabled)
+}
+
+// HasCapability reports whether the session enabled a capability
+func (s *Session) HasCapability(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.caps[name]
+}
+
+func sortedCapabilities(caps map[string]bool) []string {
+	names := make([]string, 0, len(caps))
+	for name := range caps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxHighlightWords is how many highlight words a user can have
+const MaxHighlightWords = 20
+
+// MentionedNicknames returns the nicknames a message addresses with
+// @nickname, in order and without repeats. Trailing punctuation as in
+// "@alice:" or "@bob," is not part of the nickname.
+func MentionedNicknames(text string) []string {
+	var nicknames []string
+	seen := make(map[string]bool)
+
+	for _, field := range strings.Fields(text) {
+		at := strings.IndexByte(field, '@')
+		if at < 0 || wordRuneBefore(field, at) {
+			continue // not a mention, e.g. an email address
+		}
+		nickname := strings.TrimRightFunc(field[at+1:], func(r rune) bool {
+			return strings.ContainsRune(".,:;!?)'\"", r)
+		})
+		if nickname == "" || seen[strings.ToLower(nickname)] {
+			continue
+		}
+		seen[strings.ToLower(nickname)] = true
+		nicknames = append(nicknames, nickname)
+	}
+	return nicknames
+}
+
+// MatchesHighlight reports whether a message contains one of the words as a
+// whole word, ignoring case. Words are expected in lowercase.
+func MatchesHighlight(text string, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+
+	lower := strings.ToLower(text)
+	for _, word := range words {
+		for offset := 0; ; {
+			i := strings.Index(lower[offset:], word)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			end := start + len(word)
+			if !wordRuneBefore(lower, start) && !wordRuneAt(lower, end) {
+				return true
+			}
+			offset = start + 1
+		}
+	}
+	return false
+}
+
+// NormalizeHighlightWords lowercases and trims highlight words and drops
+// empty ones and repeats. Commas separate words where they are stored, so
+// they cannot be part of one.
+func NormalizeHighlightWords(words []string) []string {
+	normalized := make([]string, 0, len(words))
+	for _, word := range words {
+		for _, part := range strings.Split(word, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if part != "" && !slices.Contains(normalized, part) {
+				normalized = append(normalized, part)
+			}
+		}
+	}
+	return normalized
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func wordRuneBefore(s string, i int) bool {
+	r, size := utf8.DecodeLastRuneInString(s[:i])
+	return size > 0 && isWordRune(r)
+}
+
+func wordRuneAt(s string, i int) bool {
+	r, size := utf8.DecodeRuneInString(s[i:])
+	return size > 0 && isWordRune(r)
+}
@@ -2,11 +2,13 @@ package chat
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"throwback-chat/internal/metrics"
 )
 
 // WSResponse represents a WebSocket response message
@@ -16,18 +18,59 @@ type WSResponse struct {
 	Okay  bool        `json:"okay"`
 	Error string      `json:"error,omitempty"`
 	Data  interface{} `json:"data,omitempty"`
+	Time  string      `json:"time,omitempty"` // with server-time only
+}
+
+// Conn is a client connection messages for a session are written to. It is
+// implemented by WebSocket connections and the SSE fallback transport.
+// WriteJSON is called with the session lock held and must not block for long.
+type Conn interface {
+	WriteJSON(v interface{}) error
+	Close() error
 }
 
 type Session struct {
-	ID            string          `json:"id"`
-	UserID        *int            `json:"user_id,omitempty"`
-	Nickname      *string         `json:"nickname,omitempty"`
-	Conn          *websocket.Conn `json:"-"`
-	LastHeartbeat time.Time       `json:"last_heartbeat"`
-	Channels      map[int]bool    `json:"channels"` // channel IDs user is subscribed to
-	mu            sync.Mutex      `json:"-"`
+	ID            string       `json:"id"`
+	UserID        *int         `json:"user_id,omitempty"`
+	Nickname      *string      `json:"nickname,omitempty"`
+	Conn          Conn         `json:"-"`
+	RemoteIP      string       `json:"remote_ip"`
+	LastHeartbeat time.Time    `json:"last_heartbeat"`
+	Channels      map[int]bool `json:"channels"` // channel IDs user is subscribed to
+	mu            sync.Mutex   `json:"-"`
+
+	// Requests currently being handled, mapped to whether they were
+	// answered with an error
+	inflight map[string]bool
+
+	// Set for sessions of bot accounts
+	bot *BotInfo
+
+	// Capabilities enabled with hello
+	caps map[string]bool
+}
+
+// BotInfo marks a session as belonging to a bot account and carries its
+// restrictions. Empty allow lists permit everything.
+type BotInfo struct {
+	AllowedChannels []string // normalized channel names
+	AllowedCommands []string
 }
 
+// AllowsChannel reports whether the bot may join the named channel
+func (b *BotInfo) AllowsChannel(name string) bool {
+	return len(b.AllowedChannels) == 0 || slices.Contains(b.AllowedChannels, name)
+}
+
+// AllowsCommand reports whether the bot may send a command
+func (b *BotInfo) AllowsCommand(command string) bool {
+	return len(b.AllowedCommands) == 0 || slices.Contains(b.AllowedCommands, command)
+}
+
+// HeartbeatTimeout is how long a connected session may go without a
+// heartbeat before it expires
+const HeartbeatTimeout = 60 * time.Second
+
 type SessionManager struct {
 	sessions         map[string]*Session
 	mu               sync.RWMutex
@@ -52,19 +95,20 @@ func (sm *SessionManager) SetSessionExpiredCallback(callback func(sessionID stri
 	sm.onSessionExpired = callback
 }
 
-func (sm *SessionManager) AddSession(sessionID string, conn *websocket.Conn) *Session {
+func (sm *SessionManager) AddSession(sessionID string, conn Conn, remoteIP string) *Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	session := &Session{
 		ID:            sessionID,
 		Conn:          conn,
+		RemoteIP:      remoteIP,
 		LastHeartbeat: time.Now(),
 		Channels:      make(map[int]bool),
 	}
 
 	sm.sessions[sessionID] = session
-	log.Printf("Session %s added", sessionID)
+	slog.Debug("Session added", "session_id", sessionID, "remote_ip", remoteIP)
 
 	return session
 }
@@ -81,9 +125,13 @@ func (sm *SessionManager) RemoveSession(sessionID string) {
 	defer sm.mu.Unlock()
 
 	if session, exists := sm.sessions[sessionID]; exists {
-		session.Conn.Close()
+		session.mu.Lock()
+		if session.Conn != nil {
+			session.Conn.Close()
+		}
+		session.mu.Unlock()
 		delete(sm.sessions, sessionID)
-		log.Printf("Session %s removed", sessionID)
+		slog.Debug("Session removed", "session_id", sessionID)
 	}
 }
 
@@ -100,12 +148,12 @@ func (sm *SessionManager) DisconnectSession(sessionID string) {
 			session.Conn = nil // Clear the connection but keep the session
 		}
 		session.mu.Unlock()
-		log.Printf("Session %s disconnected but kept alive for reconnection", sessionID)
+		slog.Debug("Session disconnected but kept alive for reconnection", "session_id", sessionID)
 	}
 }
 
 // TransferConnection updates an existing session with a new WebSocket connection
-func (sm *SessionManager) TransferConnection(sessionID string, conn *websocket.Conn) {
+func (sm *SessionManager) TransferConnection(sessionID string, conn Conn, remoteIP string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -117,9 +165,10 @@ func (sm *SessionManager) TransferConnection(sessionID string, conn *websocket.C
 		}
 		// Assign the new connection
 		session.Conn = conn
+		session.RemoteIP = remoteIP
 		session.LastHeartbeat = time.Now()
 		session.mu.Unlock()
-		log.Printf("Connection transferred to session %s", sessionID)
+		slog.Debug("Connection transferred to session", "session_id", sessionID, "remote_ip", remoteIP)
 	}
 }
 
@@ -164,31 +213,119 @@ func (sm *SessionManager) BroadcastToChannel(channelID int, message interface{})
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
+	fanout := 0
 	for _, session := range sm.sessions {
 		if session.IsInChannel(channelID) {
-			go func(s *Session) {
-				if err := s.SendMessage(message); err != nil {
-					log.Printf("Failed to send message to session %s: %v", s.ID, err)
-				}
-			}(session)
+			fanout++
+			go sendBroadcast(session, message)
 		}
 	}
+	metrics.BroadcastFanout.Observe(float64(fanout))
 }
 
 func (sm *SessionManager) BroadcastToAll(message interface{}) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
+	fanout := 0
 	for _, session := range sm.sessions {
 		// Only send to logged in users
 		if session.UserID != nil {
-			go func(s *Session) {
-				if err := s.SendMessage(message); err != nil {
-					log.Printf("Failed to send message to session %s: %v", s.ID, err)
-				}
-			}(session)
+			fanout++
+			go sendBroadcast(session, message)
+		}
+	}
+	metrics.BroadcastFanout.Observe(float64(fanout))
+}
+
+// BroadcastToUser sends a message to every session of a user
+func (sm *SessionManager) BroadcastToUser(userID int, message interface{}) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	fanout := 0
+	for _, session := range sm.sessions {
+		if session.UserID != nil && *session.UserID == userID {
+			fanout++
+			go sendBroadcast(session, message)
+		}
+	}
+	metrics.BroadcastFanout.Observe(float64(fanout))
+}
+
+func sendBroadcast(s *Session, message interface{}) {
+	if err := s.SendMessage(message); err != nil {
+		metrics.BroadcastSendFailures.Inc()
+		slog.Warn("Failed to send message to session", "session_id", s.ID, "error", err)
+	}
+}
+
+// SessionSnapshot is a consistent copy of a session's state for reporting
+type SessionSnapshot struct {
+	ID            string    `json:"id"`
+	UserID        *int      `json:"user_id,omitempty"`
+	Nickname      *string   `json:"nickname,omitempty"`
+	RemoteIP      string    `json:"remote_ip"`
+	Connected     bool      `json:"connected"`
+	IsBot         bool      `json:"is_bot"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	Channels      []int     `json:"channels"`
+	Capabilities  []string  `json:"capabilities"`
+}
+
+// Snapshot copies the session state while holding its lock
+func (s *Session) Snapshot() SessionSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := SessionSnapshot{
+		ID:            s.ID,
+		UserID:        s.UserID,
+		Nickname:      s.Nickname,
+		RemoteIP:      s.RemoteIP,
+		Connected:     s.Conn != nil,
+		IsBot:         s.bot != nil,
+		LastHeartbeat: s.LastHeartbeat,
+		Channels:      make([]int, 0, len(s.Channels)),
+		Capabilities:  sortedCapabilities(s.caps),
+	}
+	for channelID := range s.Channels {
+		snapshot.Channels = append(snapshot.Channels, channelID)
+	}
+	sort.Ints(snapshot.Channels)
+	return snapshot
+}
+
+// SessionStats summarizes the sessions currently held by the manager
+type SessionStats struct {
+	Connected int // sessions with an open connection
+	LoggedIn  int // connected sessions with a logged in user
+	Resumable int // logged in sessions waiting for a reconnect
+}
+
+// Stats counts sessions by connection and login state
+func (sm *SessionManager) Stats() SessionStats {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var stats SessionStats
+	for _, session := range sm.sessions {
+		session.mu.Lock()
+		connected := session.Conn != nil
+		loggedIn := session.UserID != nil
+		session.mu.Unlock()
+
+		switch {
+		case connected && loggedIn:
+			stats.Connected++
+			stats.LoggedIn++
+		case connected:
+			stats.Connected++
+		case loggedIn:
+			stats.Resumable++
 		}
 	}
+	return stats
 }
 
 // GetChannelUserCount returns the number of active sessions in a channel
@@ -216,7 +353,7 @@ func (sm *SessionManager) heartbeatChecker() {
 }
 
 func (sm *SessionManager) cleanupExpiredSessions() {
-	cutoff := time.Now().Add(-60 * time.Second) // timeout after 60 seconds
+	cutoff := time.Now().Add(-HeartbeatTimeout)
 	var expiredSessions []string
 
 	// First pass: identify expired sessions
@@ -225,9 +362,11 @@ func (sm *SessionManager) cleanupExpiredSessions() {
 		session.mu.Lock()
 		lastHeartbeat := session.LastHeartbeat
 		hasActiveConnection := session.Conn != nil
+		isBot := session.bot != nil
 		session.mu.Unlock()
 
-		if lastHeartbeat.Before(cutoff) && hasActiveConnection {
+		// Bots do not send heartbeats and stay as long as they are connected
+		if lastHeartbeat.Before(cutoff) && hasActiveConnection && !isBot {
 			expiredSessions = append(expiredSessions, sessionID)
 		}
 	}
@@ -235,27 +374,37 @@ func (sm *SessionManager) cleanupExpiredSessions() {
 
 	// Second pass: handle expired sessions
 	for _, sessionID := range expiredSessions {
-		session := sm.GetSession(sessionID)
-		if session == nil {
-			continue
+		if sm.ExpireSession(sessionID) {
+			metrics.HeartbeatExpirations.Inc()
 		}
+	}
+}
 
-		log.Printf("Session %s expired (last heartbeat: %v)", sessionID, session.LastHeartbeat)
-
-		// Check if user was logged in
-		if session.UserID != nil && session.Nickname != nil {
-			// For logged-in users: call callback to generate leave events
-			if sm.onSessionExpired != nil {
-				sm.onSessionExpired(sessionID)
-			} else {
-				// Fallback: just disconnect but keep session alive
-				sm.DisconnectSession(sessionID)
-			}
+// ExpireSession treats a session as if its heartbeat timed out. Logged in
+// users get leave events and can resume the session later, anonymous
+// sessions are removed. Returns false if the session does not exist.
+func (sm *SessionManager) ExpireSession(sessionID string) bool {
+	session := sm.GetSession(sessionID)
+	if session == nil {
+		return false
+	}
+
+	slog.Info("Session expired", "session_id", sessionID, "last_heartbeat", session.LastHeartbeat)
+
+	// Check if user was logged in
+	if session.UserID != nil && session.Nickname != nil {
+		// For logged-in users: call callback to generate leave events
+		if sm.onSessionExpired != nil {
+			sm.onSessionExpired(sessionID)
 		} else {
-			// Not logged in, remove completely
-			sm.RemoveSession(sessionID)
+			// Fallback: just disconnect but keep session alive
+			sm.DisconnectSession(sessionID)
 		}
+	} else {
+		// Not logged in, remove completely
+		sm.RemoveSession(sessionID)
 	}
+	return true
 }
 
 // RemoveSessionWithLeaveEvents removes a session and returns info needed to generate leave events
@@ -272,15 +421,32 @@ func (sm *SessionManager) RemoveSessionWithLeaveEvents(sessionID string) (userID
 		for channelID := range session.Channels {
 			channels = append(channels, channelID)
 		}
+		if session.Conn != nil {
+			session.Conn.Close()
+		}
 		session.mu.Unlock()
 
-		session.Conn.Close()
 		delete(sm.sessions, sessionID)
-		log.Printf("Session %s removed with leave events", sessionID)
+		slog.Debug("Session removed with leave events", "session_id", sessionID)
 	}
 	return
 }
 
+// Logger returns a logger annotated with the session's connection details
+func (s *Session) Logger() *slog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := []any{"session_id", s.ID}
+	if s.UserID != nil {
+		attrs = append(attrs, "user_id", *s.UserID)
+	}
+	if s.RemoteIP != "" {
+		attrs = append(attrs, "remote_ip", s.RemoteIP)
+	}
+	return slog.With(attrs...)
+}
+
 func (s *Session) SetUser(userID int, nickname string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -289,6 +455,42 @@ func (s *Session) SetUser(userID int, nickname string) {
 	s.Nickname = &nickname
 }
 
+// HasConn reports whether conn is the session's current connection. It
+// turns false once the session moved to another connection.
+func (s *Session) HasConn(conn Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Conn == conn
+}
+
+// CloseConn closes the session's current connection without detaching it,
+// so the transport notices and handles the disconnect as usual
+func (s *Session) CloseConn() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Conn != nil {
+		s.Conn.Close()
+	}
+}
+
+// SetBot marks the session as a bot session with the given restrictions
+func (s *Session) SetBot(bot *BotInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bot = bot
+}
+
+// Bot returns the bot restrictions of the session, or nil for humans
+func (s *Session) Bot() *BotInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bot
+}
+
 func (s *Session) ClearUser() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -298,6 +500,12 @@ func (s *Session) ClearUser() {
 }
 
 func (s *Session) SendMessage(message interface{}) error {
+	if negotiated, ok := message.(Negotiated); ok {
+		if message = negotiated.ForSession(s); message == nil {
+			return nil
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -311,9 +519,17 @@ func (s *Session) SendMessage(message interface{}) error {
 // RespondError sends an error response for a WebSocket request
 // If originalErr is provided, it will be logged with the error message
 func (s *Session) RespondError(reqID string, errorMsg string, originalErr error) error {
+	s.mu.Lock()
+	if _, tracked := s.inflight[reqID]; tracked {
+		s.inflight[reqID] = true
+	}
+	s.mu.Unlock()
+
 	// Log the original error if provided
 	if originalErr != nil {
-		log.Printf("Session %s error (req_id: %s): %s - original error: %v", s.ID, reqID, errorMsg, originalErr)
+		s.Logger().Error(errorMsg, "req_id", reqID, "error", originalErr)
+	} else {
+		s.Logger().Debug("Command rejected", "req_id", reqID, "reason", errorMsg)
 	}
 
 	response := WSResponse{
@@ -321,6 +537,7 @@ func (s *Session) RespondError(reqID string, errorMsg string, originalErr error)
 		ReqID: reqID,
 		Okay:  false,
 		Error: errorMsg,
+		Time:  s.serverTime(),
 	}
 	return s.SendMessage(response)
 }
@@ -332,10 +549,41 @@ func (s *Session) RespondSuccess(reqID string, data interface{}) error {
 		ReqID: reqID,
 		Okay:  true,
 		Data:  data,
+		Time:  s.serverTime(),
 	}
 	return s.SendMessage(response)
 }
 
+// serverTime returns the current time for responses to sessions with
+// server-time, and nothing otherwise
+func (s *Session) serverTime() string {
+	if !s.HasCapability(CapServerTime) {
+		return ""
+	}
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// TrackRequest starts tracking a request until the returned function is
+// called, which reports whether the request was answered with an error.
+func (s *Session) TrackRequest(reqID string) (done func() (failed bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inflight == nil {
+		s.inflight = make(map[string]bool)
+	}
+	s.inflight[reqID] = false
+
+	return func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		failed := s.inflight[reqID]
+		delete(s.inflight, reqID)
+		return failed
+	}
+}
+
 func (s *Session) JoinChannel(channelID int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
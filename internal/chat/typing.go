@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// TypingTimeout is how long a user counts as typing after their last
+	// typing notice
+	TypingTimeout = 6 * time.Second
+
+	// typingRelayInterval throttles repeated notices from someone who is
+	// already typing. Clients send one every few keystrokes, members only
+	// need a refresh before their own timeout runs out.
+	typingRelayInterval = 3 * time.Second
+)
+
+// TypingUpdate tells that a user started or stopped typing in a channel
+type TypingUpdate struct {
+	ChannelID int
+	UserID    int
+	Nickname  string
+	Typing    bool
+}
+
+type typingKey struct {
+	channelID int
+	userID    int
+}
+
+type typist struct {
+	nickname string
+	relayed  time.Time // when the last start was passed on
+	expires  time.Time
+	timer    *time.Timer
+}
+
+// TypingTracker keeps track of who is typing where. Nothing of it is
+// persisted, it only decides which updates to pass on.
+type TypingTracker struct {
+	mu      sync.Mutex
+	typists map[typingKey]*typist
+	notify  func(TypingUpdate)
+}
+
+// NewTypingTracker creates a tracker that passes updates to notify. notify
+// is called with the tracker's lock held and must not call back into the
+// tracker. Broadcasts are delivered to each session separately, so a session
+// may still see a start after the stop that followed it.
+func NewTypingTracker(notify func(TypingUpdate)) *TypingTracker {
+	return &TypingTracker{
+		typists: make(map[typingKey]*typist),
+		notify:  notify,
+	}
+}
+
+// Start marks a user as typing until TypingTimeout passes without another
+// Start
+func (t *TypingTracker) Start(channelID, userID int, nickname string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{channelID: channelID, userID: userID}
+	now := time.Now()
+
+	entry := t.typists[key]
+	if entry == nil {
+		entry = &typist{}
+		entry.timer = time.AfterFunc(TypingTimeout, func() { t.expire(key, entry) })
+		t.typists[key] = entry
+	} else {
+		entry.timer.Reset(TypingTimeout)
+	}
+	entry.nickname = nickname
+	entry.expires = now.Add(TypingTimeout)
+
+	if now.Sub(entry.relayed) >= typingRelayInterval {
+		entry.relayed = now
+		t.notify(TypingUpdate{ChannelID: channelID, UserID: userID, Nickname: nickname, Typing: true})
+	}
+}
+
+// Stop marks a user as no longer typing, if they were
+func (t *TypingTracker) Stop(channelID, userID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stop(typingKey{channelID: channelID, userID: userID})
+}
+
+// expire stops an entry unless it was refreshed or replaced since the timer
+// was set
+func (t *TypingTracker) expire(key typingKey, entry *typist) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.typists[key] != entry || time.Now().Before(entry.expires) {
+		return
+	}
+	t.stop(key)
+}
+
+func (t *TypingTracker) stop(key typingKey) {
+	entry := t.typists[key]
+	if entry == nil {
+		return
+	}
+	entry.timer.Stop()
+	delete(t.typists, key)
+	t.notify(TypingUpdate{ChannelID: key.channelID, UserID: key.userID, Nickname: entry.nickname, Typing: false})
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"modernc.org/sqlite"
+	"throwback-chat/internal/metrics"
+)
+
+// instrumentedConnector opens SQLite connections that record the latency of
+// every query and exec against the pool they belong to. Statements prepared
+// explicitly are passed through untimed.
+type instrumentedConnector struct {
+	dsn    string
+	pool   string
+	driver *sqlite.Driver
+}
+
+func newInstrumentedConnector(dsn, pool string) *instrumentedConnector {
+	return &instrumentedConnector{
+		dsn:    dsn,
+		pool:   pool,
+		driver: &sqlite.Driver{},
+	}
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, pool: c.pool}, nil
+}
+
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type instrumentedConn struct {
+	driver.Conn
+	pool string
+}
+
+func (c *instrumentedConn) observe(op string, start time.Time) {
+	metrics.DBQueryDuration.WithLabelValues(c.pool, op).Observe(time.Since(start).Seconds())
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer c.observe("query", time.Now())
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer c.observe("exec", time.Now())
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
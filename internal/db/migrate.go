@@ -0,0 +1,384 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// goMigrationChecksum is recorded for Go migrations. Their code is compiled
+// into the binary so there is no file content that could drift.
+const goMigrationChecksum = "go"
+
+// Migration is a single schema or data migration. SQL migrations are loaded
+// from the embedded migrations directory, Go migrations are registered with
+// RegisterMigration.
+type Migration struct {
+	Name     string
+	Checksum string
+	Up       func(tx *sql.Tx) error
+	Down     func(tx *sql.Tx) error
+}
+
+// MigrationState describes a migration as seen by the status command
+type MigrationState struct {
+	Name       string
+	Applied    bool
+	AppliedAt  *time.Time
+	Modified   bool // applied checksum differs from the current file
+	Missing    bool // applied but unknown to this binary
+	Reversible bool
+}
+
+type appliedMigration struct {
+	Filename  string         `db:"filename"`
+	Checksum  sql.NullString `db:"checksum"`
+	AppliedAt time.Time      `db:"applied_at"`
+}
+
+var goMigrations []Migration
+
+// RegisterMigration registers a migration implemented in Go, typically a
+// data backfill. The name decides the ordering relative to the SQL files, so
+// it should carry the same numeric prefix (e.g. "0003_backfill_foo.go").
+// Down may be nil if the migration cannot be reverted.
+func RegisterMigration(name string, up, down func(tx *sql.Tx) error) {
+	goMigrations = append(goMigrations, Migration{
+		Name:     name,
+		Checksum: goMigrationChecksum,
+		Up:       up,
+		Down:     down,
+	})
+}
+
+// execSQL returns a migration step that runs a whole SQL script. The script
+// is handed to SQLite in one piece so triggers and string literals containing
+// semicolons are left intact.
+func execSQL(script string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}
+}
+
+// loadMigrations returns all known migrations sorted by name. A SQL migration
+// "NNNN_name.sql" may be accompanied by a "NNNN_name.down.sql" file that
+// reverts it.
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration files: %w", err)
+	}
+
+	downScripts := make(map[string]string)
+	var upFiles []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+			content, err := migrationFiles.ReadFile(path.Join("migrations", name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read migration file %s: %w", name, err)
+			}
+			downScripts[base+".sql"] = string(content)
+		} else if strings.HasSuffix(name, ".sql") {
+			upFiles = append(upFiles, name)
+		}
+	}
+
+	var migrations []Migration
+	for _, name := range upFiles {
+		content, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", name, err)
+		}
+
+		sum := sha256.Sum256(content)
+		m := Migration{
+			Name:     name,
+			Checksum: hex.EncodeToString(sum[:]),
+			Up:       execSQL(string(content)),
+		}
+		if down, ok := downScripts[name]; ok {
+			m.Down = execSQL(down)
+		}
+		migrations = append(migrations, m)
+	}
+
+	migrations = append(migrations, goMigrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Name == migrations[i-1].Name {
+			return nil, fmt.Errorf("duplicate migration %s", migrations[i].Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the bookkeeping table and upgrades tables
+// created before checksums were recorded.
+func (db *DB) ensureMigrationsTable() error {
+	if _, err := db.writeDB.Exec(`
+		CREATE TABLE IF NOT EXISTS migrations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			filename TEXT NOT NULL UNIQUE,
+			checksum TEXT,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var hasChecksum bool
+	if err := db.writeDBX.Get(&hasChecksum,
+		"SELECT COUNT(*) > 0 FROM pragma_table_info('migrations') WHERE name = 'checksum'"); err != nil {
+		return fmt.Errorf("failed to inspect migrations table: %w", err)
+	}
+	if !hasChecksum {
+		if _, err := db.writeDB.Exec("ALTER TABLE migrations ADD COLUMN checksum TEXT"); err != nil {
+			return fmt.Errorf("failed to add checksum column: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) appliedMigrations() (map[string]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := db.writeDBX.Select(&rows, "SELECT filename, checksum, applied_at FROM migrations"); err != nil {
+		return nil, fmt.Errorf("failed to query migrations: %w", err)
+	}
+
+	applied := make(map[string]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Filename] = row
+	}
+	return applied, nil
+}
+
+// verifyChecksums fails if an applied migration was edited afterwards.
+// Migrations applied before checksums existed get their checksum recorded.
+func (db *DB) verifyChecksums(migrations []Migration, applied map[string]appliedMigration) error {
+	for _, m := range migrations {
+		record, ok := applied[m.Name]
+		if !ok {
+			continue
+		}
+
+		if !record.Checksum.Valid {
+			if _, err := db.writeDB.Exec("UPDATE migrations SET checksum = ? WHERE filename = ?", m.Checksum, m.Name); err != nil {
+				return fmt.Errorf("failed to record checksum for %s: %w", m.Name, err)
+			}
+			continue
+		}
+
+		if record.Checksum.String != m.Checksum {
+			return fmt.Errorf("migration %s was modified after it was applied (recorded checksum %s, current %s)",
+				m.Name, record.Checksum.String, m.Checksum)
+		}
+	}
+
+	for name := range applied {
+		if !containsMigration(migrations, name) {
+			slog.Warn("Applied migration is unknown to this binary", "migration", name)
+		}
+	}
+
+	return nil
+}
+
+func containsMigration(migrations []Migration, name string) bool {
+	for _, m := range migrations {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RunMigrations applies all pending migrations. Each migration runs in its
+// own transaction together with its bookkeeping row, so a failure leaves the
+// schema at the last fully applied migration.
+func (db *DB) RunMigrations() error {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	if err := db.verifyChecksums(migrations, applied); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Name]; ok {
+			continue
+		}
+
+		slog.Info("Running migration", "migration", m.Name)
+
+		if err := db.inTx(func(tx *sql.Tx) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO migrations (filename, checksum) VALUES (?, ?)", m.Name, m.Checksum)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDownTo reverts applied migrations newer than target, newest first.
+// The target may be given as a full name or by its numeric prefix; "0"
+// reverts everything.
+func (db *DB) MigrateDownTo(target string) error {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	if err := db.verifyChecksums(migrations, applied); err != nil {
+		return err
+	}
+
+	cutoff := -1
+	if target != "0" {
+		cutoff = findMigration(migrations, target)
+		if cutoff < 0 {
+			return fmt.Errorf("unknown migration %q", target)
+		}
+	}
+
+	for i := len(migrations) - 1; i > cutoff; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Name]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %s cannot be reverted", m.Name)
+		}
+
+		slog.Info("Reverting migration", "migration", m.Name)
+
+		if err := db.inTx(func(tx *sql.Tx) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM migrations WHERE filename = ?", m.Name)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to revert migration %s: %w", m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func findMigration(migrations []Migration, target string) int {
+	for i, m := range migrations {
+		version, _, _ := strings.Cut(m.Name, "_")
+		if m.Name == target || version == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// MigrationStatus reports every known and every applied migration
+func (db *DB) MigrationStatus() ([]MigrationState, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		state := MigrationState{
+			Name:       m.Name,
+			Reversible: m.Down != nil,
+		}
+		if record, ok := applied[m.Name]; ok {
+			appliedAt := record.AppliedAt
+			state.Applied = true
+			state.AppliedAt = &appliedAt
+			state.Modified = record.Checksum.Valid && record.Checksum.String != m.Checksum
+		}
+		states = append(states, state)
+	}
+
+	for name, record := range applied {
+		if containsMigration(migrations, name) {
+			continue
+		}
+		appliedAt := record.AppliedAt
+		states = append(states, MigrationState{
+			Name:      name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Missing:   true,
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+
+	return states, nil
+}
+
+// inTx runs fn in a write transaction and commits if it succeeds
+func (db *DB) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.writeDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
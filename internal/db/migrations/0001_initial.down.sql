@@ -0,0 +1,6 @@
+-- Revert the initial database schema for ThrowBackChat
+
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS ops;
+DROP TABLE IF EXISTS channels;
+DROP TABLE IF EXISTS users;
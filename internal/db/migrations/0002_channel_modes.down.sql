@@ -0,0 +1,2 @@
+ALTER TABLE channels DROP COLUMN is_private;
+ALTER TABLE channels DROP COLUMN is_secret;
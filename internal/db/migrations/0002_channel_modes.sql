@@ -0,0 +1,7 @@
+-- Channel visibility modes
+-- Secret channels are hidden from channel lists and the REST API.
+-- Private channels are listed, but their members and history are not exposed
+-- through the REST API.
+
+ALTER TABLE channels ADD COLUMN is_secret BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE channels ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
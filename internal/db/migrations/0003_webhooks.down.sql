@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhooks_channel_id;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,16 @@
+-- Incoming webhooks
+-- Each webhook posts into a single channel under its own nickname. The token
+-- is the secret part of the webhook URL.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel_id INTEGER NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    nickname TEXT NOT NULL DEFAULT '',
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_channel_id ON webhooks(channel_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_id;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS idx_outgoing_webhooks_channel_event;
+DROP TABLE IF EXISTS outgoing_webhooks;
@@ -0,0 +1,37 @@
+-- Outgoing webhooks
+-- An outgoing webhook POSTs to its URL when an event happens in its channel.
+-- Message events can be narrowed down with a prefix or regex match. Every
+-- delivery attempt is recorded in webhook_deliveries.
+
+CREATE TABLE IF NOT EXISTS outgoing_webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event TEXT NOT NULL, -- 'message', 'joined', 'left', 'topic_change'
+    match_type TEXT NOT NULL DEFAULT '', -- '', 'prefix', 'regex'
+    pattern TEXT NOT NULL DEFAULT '',
+    post_response BOOLEAN NOT NULL DEFAULT FALSE,
+    nickname TEXT NOT NULL DEFAULT '',
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outgoing_webhooks_channel_event ON outgoing_webhooks(channel_id, event);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0, -- 0 if no response was received
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL,
+    delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (webhook_id) REFERENCES outgoing_webhooks(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
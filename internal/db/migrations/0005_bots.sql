@@ -0,0 +1,16 @@
+-- Bot accounts
+-- Bots are users that authenticate to /ws with a long-lived token instead of
+-- picking a nickname. Only the SHA-256 hash of the token is stored. The allow
+-- lists are comma separated channel names and commands; empty allows all.
+
+ALTER TABLE users ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS bots (
+    user_id INTEGER PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    allowed_channels TEXT NOT NULL DEFAULT '',
+    allowed_commands TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
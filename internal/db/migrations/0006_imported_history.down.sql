@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_messages_channel_sent_at;
+DROP INDEX IF EXISTS idx_messages_import_key;
+DELETE FROM messages WHERE import_key IS NOT NULL;
+ALTER TABLE messages DROP COLUMN import_key;
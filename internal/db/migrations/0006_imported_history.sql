@@ -0,0 +1,11 @@
+-- Imported history
+-- Messages imported from IRC client logs carry a key derived from their
+-- content, so importing the same log twice doesn't duplicate them. Imported
+-- joins and parts are history only and never count towards membership.
+-- Imported messages are older than their IDs suggest, so history is ordered
+-- by sent_at, which the second index serves.
+
+ALTER TABLE messages ADD COLUMN import_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_import_key ON messages(import_key);
+CREATE INDEX IF NOT EXISTS idx_messages_channel_sent_at ON messages(channel_id, sent_at, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_channel_id;
+DROP TABLE IF EXISTS read_markers;
@@ -0,0 +1,16 @@
+-- Read markers
+-- The last message each user has read per channel. Markers only move
+-- forward, unread counts are everything after them.
+
+CREATE TABLE IF NOT EXISTS read_markers (
+    user_id INTEGER NOT NULL,
+    channel_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, channel_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+-- Counting what comes after a marker
+CREATE INDEX IF NOT EXISTS idx_messages_channel_id ON messages(channel_id, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_mentions_user_channel;
+DROP TABLE IF EXISTS mentions;
+ALTER TABLE users DROP COLUMN highlights;
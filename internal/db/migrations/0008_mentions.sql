@@ -0,0 +1,21 @@
+-- Mentions and highlight words
+-- A mention is stored for every user a message names with @nickname or
+-- matches one of their highlight words. Highlight words are a comma
+-- separated, lowercase list per user.
+
+ALTER TABLE users ADD COLUMN highlights TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS mentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    channel_id INTEGER NOT NULL,
+    seen BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, message_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_channel ON mentions(user_id, channel_id, message_id);
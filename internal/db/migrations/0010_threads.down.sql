@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_reply_to;
+ALTER TABLE messages DROP COLUMN reply_broadcast;
+ALTER TABLE messages DROP COLUMN reply_to;
@@ -0,0 +1,8 @@
+-- Threaded replies
+-- A reply points at the message that started its thread. Replies stay out of
+-- the channel's history unless they were also broadcast to the channel.
+
+ALTER TABLE messages ADD COLUMN reply_to INTEGER;
+ALTER TABLE messages ADD COLUMN reply_broadcast BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to ON messages(reply_to, sent_at, id);
@@ -0,0 +1,13 @@
+-- Pinned messages
+-- Channel ops pin chat messages of their channel, e.g. runbook links.
+
+CREATE TABLE IF NOT EXISTS pins (
+    channel_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    pinned_by INTEGER NOT NULL,
+    pinned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, message_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (pinned_by) REFERENCES users(id)
+);
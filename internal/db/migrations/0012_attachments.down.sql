@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_attachments_channel_id;
+DROP INDEX IF EXISTS idx_attachments_message_id;
+DROP TABLE IF EXISTS attachments;
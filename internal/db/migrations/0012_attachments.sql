@@ -0,0 +1,24 @@
+-- File attachments
+-- An attachment is one upload of a file. The file itself is stored on disk
+-- under its SHA-256, shared by all uploads of the same content. Sending a
+-- message with the attachment sets its message and channel; until then only
+-- the uploader can use it. Downloads are addressed by the random token.
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token TEXT NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    message_id INTEGER,
+    channel_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments(message_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_channel_id ON attachments(channel_id);
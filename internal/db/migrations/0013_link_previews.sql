@@ -0,0 +1,25 @@
+-- Link previews
+-- link_previews caches what was fetched for a URL, including failures so
+-- broken links aren't fetched for every message. message_previews ties the
+-- previews to the messages that contained the URLs, in the order they
+-- appeared.
+
+CREATE TABLE IF NOT EXISTS link_previews (
+    url TEXT PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image TEXT NOT NULL DEFAULT '',
+    site_name TEXT NOT NULL DEFAULT '',
+    ok BOOLEAN NOT NULL,
+    fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS message_previews (
+    message_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    channel_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (message_id, url),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
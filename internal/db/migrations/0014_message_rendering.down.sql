@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN plain;
+ALTER TABLE messages DROP COLUMN html;
@@ -0,0 +1,7 @@
+-- Rendered messages
+-- Chat messages are stored with their markdown rendered to sanitized HTML
+-- and to plain text. Other events keep both empty. Existing messages are
+-- rendered by the Go migration that follows.
+
+ALTER TABLE messages ADD COLUMN html TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN plain TEXT NOT NULL DEFAULT '';
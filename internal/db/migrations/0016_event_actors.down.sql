@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN actor_nickname;
+ALTER TABLE messages DROP COLUMN actor_id;
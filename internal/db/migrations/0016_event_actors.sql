@@ -0,0 +1,7 @@
+-- Event actors
+-- Events caused by another user than the one they are about, like kicks,
+-- record who caused them. The nickname is kept as it was at the time, like
+-- the nickname of the event's user.
+
+ALTER TABLE messages ADD COLUMN actor_id INTEGER;
+ALTER TABLE messages ADD COLUMN actor_nickname TEXT NOT NULL DEFAULT '';
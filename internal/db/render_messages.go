@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+
+	"throwback-chat/internal/markdown"
+)
+
+// renderBatchSize is how many messages the rendering backfill loads at once
+const renderBatchSize = 500
+
+func init() {
+	RegisterMigration("0015_render_messages.go", renderMessages, clearRenderedMessages)
+}
+
+// renderMessages renders the chat messages stored before messages were
+// rendered when they are sent
+func renderMessages(tx *sql.Tx) error {
+	type pending struct {
+		id      int
+		message string
+	}
+
+	lastID := 0
+	for {
+		rows, err := tx.Query(`SELECT id, message FROM messages
+			WHERE event = 'message' AND id > ? ORDER BY id LIMIT ?`, lastID, renderBatchSize)
+		if err != nil {
+			return err
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.message); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, p := range batch {
+			rendered := markdown.Render(p.message)
+			if _, err := tx.Exec("UPDATE messages SET html = ?, plain = ? WHERE id = ?",
+				rendered.HTML, rendered.Plain, p.id); err != nil {
+				return err
+			}
+		}
+		lastID = batch[len(batch)-1].id
+	}
+}
+
+func clearRenderedMessages(tx *sql.Tx) error {
+	_, err := tx.Exec("UPDATE messages SET html = '', plain = ''")
+	return err
+}
@@ -0,0 +1,267 @@
+// Package export writes channel history as IRC style text logs, JSON lines
+// or a self-contained HTML page.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/models"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	FormatText  Format = "text"
+	FormatJSONL Format = "jsonl"
+	FormatHTML  Format = "html"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{FormatText, FormatJSONL, FormatHTML}
+
+// ParseFormat validates a format name. An empty name selects text.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatText, nil
+	}
+	for _, format := range Formats {
+		if string(format) == strings.ToLower(name) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown export format %q", name)
+}
+
+// Extension returns the file extension for exports in this format
+func (f Format) Extension() string {
+	switch f {
+	case FormatJSONL:
+		return "jsonl"
+	case FormatHTML:
+		return "html"
+	default:
+		return "log"
+	}
+}
+
+// ContentType returns the MIME type of exports in this format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSONL:
+		return "application/jsonl; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Options selects what to export. Zero times leave that end of the range
+// open. Timestamps are shown in Location, which defaults to UTC.
+type Options struct {
+	Channel  *models.Channel
+	Format   Format
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// Filename suggests a name for the export file, like
+// "ops-2026-10-01-2026-10-02.log"
+func (o Options) Filename() string {
+	name := strings.TrimLeft(o.Channel.Name, "#")
+	if !o.From.IsZero() {
+		name += "-" + o.From.In(o.location()).Format(time.DateOnly)
+	}
+	if !o.To.IsZero() {
+		// The end of the range is exclusive, name the last day it covers
+		name += "-" + o.To.Add(-time.Nanosecond).In(o.location()).Format(time.DateOnly)
+	}
+	return name + "." + o.Format.Extension()
+}
+
+func (o Options) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// ParseTime parses the bound of an export range, either an RFC 3339
+// timestamp or a date in loc. A date used as the end of the range includes
+// that whole day.
+func ParseTime(value string, loc *time.Location, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// encoder writes one export format
+type encoder interface {
+	begin() error
+	message(*models.Message) error
+	end() error
+}
+
+// Write exports the channel history selected by opts to w
+func Write(w io.Writer, database *db.DB, opts Options) error {
+	buffered := bufio.NewWriter(w)
+
+	var enc encoder
+	switch opts.Format {
+	case FormatText, "":
+		enc = &textEncoder{w: buffered, opts: opts, events: newEventDescriber(opts.Channel.Name)}
+	case FormatJSONL:
+		enc = &jsonlEncoder{enc: json.NewEncoder(buffered)}
+	case FormatHTML:
+		enc = &htmlEncoder{w: buffered, opts: opts, events: newEventDescriber(opts.Channel.Name)}
+	default:
+		return fmt.Errorf("unknown export format %q", opts.Format)
+	}
+
+	if err := enc.begin(); err != nil {
+		return err
+	}
+	err := models.ForEachMessageInRange(database, opts.Channel.ID, opts.From, opts.To, enc.message)
+	if err != nil {
+		return err
+	}
+	if err := enc.end(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// eventDescriber words channel events like irssi does. It remembers the last
+// nickname of each user, which nick change events don't record.
+type eventDescriber struct {
+	channel   string
+	nicknames map[int]string
+}
+
+func newEventDescriber(channel string) *eventDescriber {
+	return &eventDescriber{channel: channel, nicknames: map[int]string{}}
+}
+
+// describe returns the text of an event, or "" for chat messages. It has to
+// see every message to keep track of nicknames.
+func (d *eventDescriber) describe(m *models.Message) string {
+	previous, known := d.nicknames[m.UserID]
+	d.nicknames[m.UserID] = m.Nickname
+
+	switch m.Event {
+	case "message":
+		return ""
+	case "joined":
+		return fmt.Sprintf("%s has joined %s", m.Nickname, d.channel)
+	case "left":
+		return fmt.Sprintf("%s has left %s%s", m.Nickname, d.channel, bracketed(m.Message))
+	case "kicked":
+		if m.ActorNickname != "" {
+			return fmt.Sprintf("%s was kicked from %s by %s%s", m.Nickname, d.channel, m.ActorNickname, bracketed(m.Message))
+		}
+		return fmt.Sprintf("%s was kicked from %s%s", m.Nickname, d.channel, bracketed(m.Message))
+	case "topic_change":
+		if m.Message == "Topic cleared" {
+			return fmt.Sprintf("%s cleared the topic of %s", m.Nickname, d.channel)
+		}
+		return fmt.Sprintf("%s changed the topic of %s to: %s", m.Nickname, d.channel, m.Message)
+	case "nick_change":
+		// Older nick changes don't store the old nickname
+		if m.Message != "" {
+			return fmt.Sprintf("%s is now known as %s", m.Message, m.Nickname)
+		}
+		if known && previous != m.Nickname {
+			return fmt.Sprintf("%s is now known as %s", previous, m.Nickname)
+		}
+		return fmt.Sprintf("User %d is now known as %s", m.UserID, m.Nickname)
+	case "announcement":
+		return fmt.Sprintf("Announcement from %s: %s", m.Nickname, m.Message)
+	default:
+		return fmt.Sprintf("%s: %s %s", m.Event, m.Nickname, m.Message)
+	}
+}
+
+func bracketed(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " [" + reason + "]"
+}
+
+// textEncoder writes irssi style logs:
+//
+//	[14:02] <alice> hello
+//	[14:02] * alice waves
+//	[14:03] -!- bob has joined #ops
+type textEncoder struct {
+	w      *bufio.Writer
+	opts   Options
+	day    string
+	events *eventDescriber
+}
+
+func (e *textEncoder) begin() error {
+	_, err := fmt.Fprintf(e.w, "--- Log opened for %s\n", e.opts.Channel.Name)
+	return err
+}
+
+func (e *textEncoder) message(m *models.Message) error {
+	sentAt := m.SentAt.In(e.opts.location())
+	if day := sentAt.Format("Mon Jan 02 2006"); day != e.day {
+		if _, err := fmt.Fprintf(e.w, "--- Day changed %s\n", day); err != nil {
+			return err
+		}
+		e.day = day
+	}
+
+	line := "-!- " + e.events.describe(m)
+	switch {
+	case m.Event == "message" && m.IsPassive:
+		line = fmt.Sprintf("* %s %s", m.Nickname, m.Message)
+	case m.Event == "message":
+		line = fmt.Sprintf("<%s> %s", m.Nickname, m.Message)
+	}
+
+	_, err := fmt.Fprintf(e.w, "[%s] %s\n", sentAt.Format("15:04"), line)
+	return err
+}
+
+func (e *textEncoder) end() error {
+	_, err := fmt.Fprintf(e.w, "--- Log closed for %s\n", e.opts.Channel.Name)
+	return err
+}
+
+// jsonlEncoder writes one JSON message object per line
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) begin() error { return nil }
+
+func (e *jsonlEncoder) message(m *models.Message) error {
+	return e.enc.Encode(m)
+}
+
+func (e *jsonlEncoder) end() error { return nil }
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bufio"
+	"html/template"
+	"time"
+
+	"throwback-chat/internal/models"
+)
+
+// htmlTemplate renders a page without external resources, so it can be
+// attached to a postmortem as a single file
+var htmlTemplate = template.Must(template.New("export").Parse(`
+{{- define "begin" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Channel.Name}} log</title>
+<style>
+body { background: #000; color: #c0c0c0; font: 14px/1.4 "Courier New", monospace; margin: 1em; }
+h1 { color: #fff; font-size: 16px; }
+.range { color: #808080; }
+table { border-collapse: collapse; }
+td { padding: 0 0.5em; vertical-align: top; white-space: pre-wrap; }
+.time { color: #808080; white-space: nowrap; }
+.nick { color: #00ffff; text-align: right; white-space: nowrap; }
+.action { color: #ff00ff; }
+.event { color: #00ff00; }
+.announcement { color: #ffff00; }
+.day td { color: #fff; padding-top: 0.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Channel.Name}}</h1>
+<p class="range">{{.Range}}</p>
+<table>
+{{end -}}
+
+{{- define "day" -}}
+<tr class="day"><td colspan="3">{{.}}</td></tr>
+{{end -}}
+
+{{- define "message" -}}
+<tr id="m{{.ID}}" class="{{.Class}}"><td class="time"><time datetime="{{.DateTime}}">{{.Time}}</time></td><td class="nick">{{.Nick}}</td><td>{{.Text}}</td></tr>
+{{end -}}
+
+{{- define "end" -}}
+</table>
+</body>
+</html>
+{{end -}}
+`))
+
+type htmlHeader struct {
+	Channel *models.Channel
+	Range   string
+}
+
+type htmlMessage struct {
+	ID       int
+	Class    string
+	DateTime string
+	Time     string
+	Nick     string
+	Text     string
+}
+
+type htmlEncoder struct {
+	w      *bufio.Writer
+	opts   Options
+	day    string
+	events *eventDescriber
+}
+
+func (e *htmlEncoder) begin() error {
+	loc := e.opts.location()
+	from, to := "the beginning", "now"
+	if !e.opts.From.IsZero() {
+		from = e.opts.From.In(loc).Format(time.DateTime)
+	}
+	if !e.opts.To.IsZero() {
+		to = e.opts.To.In(loc).Format(time.DateTime)
+	}
+
+	return htmlTemplate.ExecuteTemplate(e.w, "begin", htmlHeader{
+		Channel: e.opts.Channel,
+		Range:   "From " + from + " to " + to + " (" + loc.String() + ")",
+	})
+}
+
+func (e *htmlEncoder) message(m *models.Message) error {
+	sentAt := m.SentAt.In(e.opts.location())
+	if day := sentAt.Format("Monday, January 2, 2006"); day != e.day {
+		if err := htmlTemplate.ExecuteTemplate(e.w, "day", day); err != nil {
+			return err
+		}
+		e.day = day
+	}
+
+	row := htmlMessage{
+		ID:       m.ID,
+		DateTime: sentAt.Format(time.RFC3339),
+		Time:     sentAt.Format("15:04"),
+	}
+	// Events are worded like in the text log
+	event := e.events.describe(m)
+	switch {
+	case m.Event == "message" && m.IsPassive:
+		row.Class, row.Nick, row.Text = "action", "*", m.Nickname+" "+m.Message
+	case m.Event == "message":
+		row.Nick, row.Text = m.Nickname, m.Message
+	case m.Event == "announcement":
+		row.Class, row.Nick, row.Text = "announcement", "-!-", event
+	default:
+		row.Class, row.Nick, row.Text = "event", "-!-", event
+	}
+
+	return htmlTemplate.ExecuteTemplate(e.w, "message", row)
+}
+
+func (e *htmlEncoder) end() error {
+	return htmlTemplate.ExecuteTemplate(e.w, "end", nil)
+}
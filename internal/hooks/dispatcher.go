@@ -0,0 +1,310 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/netguard"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderSignature = "X-Throwback-Signature"
+	HeaderEvent     = "X-Throwback-Event"
+	HeaderDelivery  = "X-Throwback-Delivery"
+)
+
+const (
+	maxAttempts     = 4
+	initialBackoff  = time.Second
+	dialTimeout     = 5 * time.Second
+	requestTimeout  = 10 * time.Second
+	maxResponseSize = 64 << 10
+)
+
+// Events outgoing webhooks can subscribe to
+var Events = []string{"message", "joined", "left", "topic_change"}
+
+// Payload is the JSON body POSTed to outgoing webhooks
+type Payload struct {
+	WebhookID   int    `json:"webhook_id"`
+	Event       string `json:"event"`
+	ChannelID   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	MessageID   int    `json:"message_id"`
+	UserID      int    `json:"user_id"`
+	Nickname    string `json:"nickname"`
+	Text        string `json:"text"`
+	Match       string `json:"match,omitempty"`
+	SentAt      string `json:"sent_at"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// ResponseFunc posts the reply of an outgoing webhook into its channel
+type ResponseFunc func(hook *models.OutgoingWebhook, text string)
+
+// Dispatcher delivers channel events to the outgoing webhooks that match
+// them. Deliveries happen in the background and are retried with
+// exponential backoff on network errors, 429 and 5xx responses.
+type Dispatcher struct {
+	db      *db.DB
+	client  *http.Client
+	respond ResponseFunc
+	backoff time.Duration // wait before the first retry, doubled for each further one
+
+	mu      sync.Mutex
+	regexps map[string]*regexp.Regexp
+}
+
+// NewDispatcher creates a dispatcher that only delivers to public
+// addresses and to the allowed networks. Webhooks are set up by channel
+// operators, who must not be able to reach the server's own network, let
+// alone read it through posted responses.
+func NewDispatcher(database *db.DB, respond ResponseFunc, allowed []netip.Prefix) *Dispatcher {
+	dialer := &net.Dialer{Timeout: dialTimeout, Control: netguard.Control(allowed)}
+	transport := &http.Transport{
+		// No proxy, it would dial the addresses for us
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: requestTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &Dispatcher{
+		db:      database,
+		client:  &http.Client{Transport: transport, Timeout: requestTimeout},
+		respond: respond,
+		backoff: initialBackoff,
+		regexps: make(map[string]*regexp.Regexp),
+	}
+}
+
+// IsEvent reports whether outgoing webhooks can subscribe to an event
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature header value for a payload body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch fires the outgoing webhooks matching a stored channel message or
+// event. It is safe to call with a nil message, which is ignored.
+func (d *Dispatcher) Dispatch(msg *models.Message) {
+	if d == nil || msg == nil || msg.ChannelID == nil || !IsEvent(msg.Event) {
+		return
+	}
+	go d.dispatch(msg)
+}
+
+func (d *Dispatcher) dispatch(msg *models.Message) {
+	hooks, err := models.GetOutgoingWebhooksForEvent(d.db, *msg.ChannelID, msg.Event)
+	if err != nil {
+		slog.Error("Failed to load outgoing webhooks", "channel_id", *msg.ChannelID, "error", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	channel, err := models.GetChannelByID(d.db, *msg.ChannelID)
+	if err != nil || channel == nil {
+		slog.Error("Failed to load channel for outgoing webhooks", "channel_id", *msg.ChannelID, "error", err)
+		return
+	}
+
+	for i := range hooks {
+		hook := &hooks[i]
+		match, ok := d.match(hook, msg.Message)
+		if !ok {
+			continue
+		}
+
+		payload := Payload{
+			WebhookID:   hook.ID,
+			Event:       msg.Event,
+			ChannelID:   channel.ID,
+			ChannelName: channel.Name,
+			MessageID:   msg.ID,
+			UserID:      msg.UserID,
+			Nickname:    msg.Nickname,
+			Text:        msg.Message,
+			Match:       match,
+			SentAt:      msg.SentAt.UTC().Format(time.RFC3339),
+			Timestamp:   time.Now().Unix(),
+		}
+		go d.deliver(hook, payload)
+	}
+}
+
+// match checks a message against the webhook's prefix or regex and returns
+// the matched text
+func (d *Dispatcher) match(hook *models.OutgoingWebhook, text string) (string, bool) {
+	switch hook.MatchType {
+	case models.MatchPrefix:
+		if strings.HasPrefix(text, hook.Pattern) {
+			return hook.Pattern, true
+		}
+		return "", false
+	case models.MatchRegex:
+		re, err := d.compile(hook.Pattern)
+		if err != nil {
+			slog.Warn("Invalid outgoing webhook regex", "webhook_id", hook.ID, "error", err)
+			return "", false
+		}
+		if loc := re.FindStringIndex(text); loc != nil {
+			return text[loc[0]:loc[1]], true
+		}
+		return "", false
+	default:
+		return "", true
+	}
+}
+
+func (d *Dispatcher) compile(pattern string) (*regexp.Regexp, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if re, ok := d.regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	d.regexps[pattern] = re
+	return re, nil
+}
+
+// deliver POSTs the payload, retrying failed attempts, and hands the reply
+// of a successful delivery to the response callback
+func (d *Dispatcher) deliver(hook *models.OutgoingWebhook, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode outgoing webhook payload", "webhook_id", hook.ID, "error", err)
+		return
+	}
+
+	logger := slog.With("webhook_id", hook.ID, "channel_id", hook.ChannelID, "event", payload.Event, "message_id", payload.MessageID)
+	deliveryID := uuid.New().String()
+	backoff := d.backoff
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		start := time.Now()
+		statusCode, reply, err := d.post(hook, deliveryID, payload.Event, body)
+
+		delivery := &models.WebhookDelivery{
+			WebhookID:  hook.ID,
+			MessageID:  payload.MessageID,
+			Event:      payload.Event,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if recordErr := models.RecordWebhookDelivery(d.db, delivery); recordErr != nil {
+			logger.Error("Failed to record webhook delivery", "error", recordErr)
+		}
+
+		if err == nil {
+			logger.Debug("Delivered outgoing webhook", "attempt", attempt, "status", statusCode)
+			if hook.PostResponse && reply != "" && d.respond != nil {
+				d.respond(hook, reply)
+			}
+			return
+		}
+
+		retryable := statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+		if !retryable || attempt == maxAttempts {
+			logger.Warn("Outgoing webhook delivery failed", "attempt", attempt, "status", statusCode, "error", err)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post performs a single delivery attempt. A non-2xx status is reported as
+// an error together with the status code.
+func (d *Dispatcher) post(hook *models.OutgoingWebhook, deliveryID, event string, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ThrowBackChat-Webhook/1.0")
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return resp.StatusCode, "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, replyText(resp.Header.Get("Content-Type"), data), nil
+}
+
+// replyText extracts the text to post back from a webhook response. JSON
+// responses carry it in "text" (as Slack does) or "message", plain text
+// responses are used as is.
+func replyText(contentType string, data []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		var reply struct {
+			Text    string `json:"text"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(data, &reply); err != nil {
+			return ""
+		}
+		if reply.Text != "" {
+			return strings.TrimSpace(reply.Text)
+		}
+		return strings.TrimSpace(reply.Message)
+	case "text/plain":
+		return strings.TrimSpace(string(data))
+	default:
+		return ""
+	}
+}
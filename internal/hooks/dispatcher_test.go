@@ -0,0 +1,253 @@
+package hooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/models"
+)
+
+// loopback lets the dispatcher reach httptest servers
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+const testBackoff = 20 * time.Millisecond
+
+type response struct {
+	hook *models.OutgoingWebhook
+	text string
+}
+
+type fixture struct {
+	db         *db.DB
+	dispatcher *Dispatcher
+	responses  chan response
+	message    *models.Message
+}
+
+func newFixture(t *testing.T, allowed []netip.Prefix) *fixture {
+	t.Helper()
+
+	database, err := db.New(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	channel, err := models.CreateChannel(database, "#hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := models.CreateOrUpdateUser(database, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := models.CreateMessage(database, &channel.ID, user.ID, "!ping", "message", user.Nickname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{db: database, responses: make(chan response, 1), message: message}
+	f.dispatcher = NewDispatcher(database, func(hook *models.OutgoingWebhook, text string) {
+		f.responses <- response{hook, text}
+	}, allowed)
+	f.dispatcher.backoff = testBackoff
+	return f
+}
+
+func (f *fixture) createHook(t *testing.T, url string) *models.OutgoingWebhook {
+	t.Helper()
+	hook, err := models.CreateOutgoingWebhook(f.db, &models.OutgoingWebhook{
+		ChannelID:       *f.message.ChannelID,
+		URL:             url,
+		Event:           "message",
+		PostResponse:    true,
+		CreatedByUserID: f.message.UserID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+// waitForDeliveries waits until a webhook has count recorded attempts and
+// returns them, newest first
+func (f *fixture) waitForDeliveries(t *testing.T, hook *models.OutgoingWebhook, count int) []models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := models.GetWebhookDeliveries(f.db, hook.ID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) >= count {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d deliveries, want %d", len(deliveries), count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeliverSignsPayloadAndPostsResponse(t *testing.T) {
+	f := newFixture(t, loopback)
+
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text": " pong "}`))
+	}))
+	defer server.Close()
+
+	hook := f.createHook(t, server.URL)
+	f.dispatcher.Dispatch(f.message)
+
+	select {
+	case got := <-f.responses:
+		if got.hook.ID != hook.ID || got.text != "pong" {
+			t.Errorf("response = %d %q, want %d %q", got.hook.ID, got.text, hook.ID, "pong")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("response was not posted")
+	}
+
+	r, body := <-requests, <-bodies
+	if got, want := r.Header.Get(HeaderSignature), Sign(hook.Secret, body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := r.Header.Get(HeaderEvent); got != "message" {
+		t.Errorf("event header = %q, want message", got)
+	}
+	if r.Header.Get(HeaderDelivery) == "" {
+		t.Error("delivery header is missing")
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.WebhookID != hook.ID || payload.MessageID != f.message.ID || payload.Text != "!ping" || payload.ChannelName != "#hooks" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	f := newFixture(t, loopback)
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		failing := len(attempts) < 3
+		mu.Unlock()
+
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	hook := f.createHook(t, server.URL)
+	f.dispatcher.Dispatch(f.message)
+
+	select {
+	case got := <-f.responses:
+		if got.text != "done" {
+			t.Errorf("response = %q, want done", got.text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("response was not posted")
+	}
+
+	deliveries := f.waitForDeliveries(t, hook, 3)
+	for i, want := range []struct{ attempt, status int }{{3, 200}, {2, 503}, {1, 503}} {
+		if deliveries[i].Attempt != want.attempt || deliveries[i].StatusCode != want.status {
+			t.Errorf("delivery %d = attempt %d status %d, want attempt %d status %d",
+				i, deliveries[i].Attempt, deliveries[i].StatusCode, want.attempt, want.status)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if first, second := attempts[1].Sub(attempts[0]), attempts[2].Sub(attempts[1]); first < testBackoff || second < 2*testBackoff {
+		t.Errorf("retried after %v and %v, want at least %v and %v", first, second, testBackoff, 2*testBackoff)
+	}
+}
+
+func TestDeliverDoesNotRetryClientErrors(t *testing.T) {
+	f := newFixture(t, loopback)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	hook := f.createHook(t, server.URL)
+	f.dispatcher.Dispatch(f.message)
+
+	deliveries := f.waitForDeliveries(t, hook, 1)
+	time.Sleep(5 * testBackoff)
+	if deliveries, _ = models.GetWebhookDeliveries(f.db, hook.ID, 10); len(deliveries) != 1 || deliveries[0].StatusCode != 404 {
+		t.Errorf("deliveries = %+v, want a single 404", deliveries)
+	}
+	select {
+	case got := <-f.responses:
+		t.Errorf("failed delivery posted response %q", got.text)
+	default:
+	}
+}
+
+func TestDeliverRefusesInternalAddresses(t *testing.T) {
+	f := newFixture(t, nil)
+
+	var mu sync.Mutex
+	reached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reached = true
+		mu.Unlock()
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	// By address and by a name that resolves to loopback
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		hook := f.createHook(t, url)
+		f.dispatcher.Dispatch(f.message)
+
+		deliveries := f.waitForDeliveries(t, hook, maxAttempts)
+		for _, delivery := range deliveries {
+			if delivery.StatusCode != 0 || !strings.Contains(delivery.Error, "not public") {
+				t.Errorf("%s: delivery = %+v, want refused", url, delivery)
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if reached {
+		t.Error("internal server was reached")
+	}
+	select {
+	case got := <-f.responses:
+		t.Errorf("refused delivery posted response %q", got.text)
+	default:
+	}
+}
@@ -0,0 +1,153 @@
+package irclog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/models"
+)
+
+// importBatchSize is how many messages are inserted per transaction
+const importBatchSize = 500
+
+// Stats counts what an import did
+type Stats struct {
+	Entries  int // lines that became messages
+	Imported int // messages that weren't imported before
+	Skipped  int // lines without a counterpart in channel history
+}
+
+// Importer imports logs into one channel. Users are looked up by nickname
+// and created as needed. Every message gets a key derived from its content,
+// so importing overlapping logs or the same log twice is harmless.
+type Importer struct {
+	db      *db.DB
+	channel *models.Channel
+	users   map[string]int
+	seen    map[string]int
+	batch   []models.ImportedMessage
+	stats   Stats
+}
+
+// NewImporter prepares an import into the named channel, creating it if it
+// doesn't exist. Imported joins and parts don't make anyone a member.
+func NewImporter(database *db.DB, channelName string) (*Importer, error) {
+	channel, err := models.GetChannelByName(database, channelName)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		if channel, err = models.CreateChannel(database, channelName); err != nil {
+			return nil, fmt.Errorf("failed to create channel: %w", err)
+		}
+	}
+
+	return &Importer{
+		db:      database,
+		channel: channel,
+		users:   map[string]int{},
+	}, nil
+}
+
+// Channel returns the channel messages are imported into
+func (im *Importer) Channel() *models.Channel {
+	return im.channel
+}
+
+// Import reads one log. Keys count repeated lines within a log, so each log
+// has to be imported with its own call.
+func (im *Importer) Import(r io.Reader, format Format, opts ParseOptions) (Stats, error) {
+	im.seen = map[string]int{}
+	im.stats = Stats{}
+
+	skipped, err := Parse(r, format, opts, im.add)
+	im.stats.Skipped = skipped
+	if err != nil {
+		return im.stats, err
+	}
+	return im.stats, im.flush()
+}
+
+func (im *Importer) add(entry Entry) error {
+	userID, err := im.userID(entry.Nickname)
+	if err != nil {
+		return err
+	}
+
+	// Like live nick changes, the event belongs to the user and carries the
+	// new nickname, with the old one as its content
+	nickname, message := entry.Nickname, entry.Message
+	if entry.Event == "nick_change" {
+		nickname, message = entry.NewNickname, entry.Nickname
+	}
+
+	imported := models.ImportedMessage{
+		ChannelID: im.channel.ID,
+		UserID:    userID,
+		SentAt:    entry.Time,
+		Message:   message,
+		IsPassive: entry.IsPassive,
+		Event:     entry.Event,
+		Nickname:  nickname,
+		ImportKey: im.key(entry),
+	}
+	if entry.Actor != "" {
+		actorID, err := im.userID(entry.Actor)
+		if err != nil {
+			return err
+		}
+		imported.ActorID = &actorID
+		imported.ActorNickname = entry.Actor
+	}
+	im.batch = append(im.batch, imported)
+	im.stats.Entries++
+
+	if len(im.batch) >= importBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// key identifies an entry by its content. Identical lines in the same
+// second are told apart by how often they occurred before. The actor is left
+// out so that kicks imported before actors were recorded keep their keys.
+func (im *Importer) key(entry Entry) string {
+	content := fmt.Sprintf("%s\x00%d\x00%s\x00%s\x00%s\x00%s\x00%t",
+		im.channel.Name, entry.Time.Unix(), entry.Event, entry.Nickname, entry.NewNickname, entry.Message, entry.IsPassive)
+	occurrence := im.seen[content]
+	im.seen[content]++
+
+	sum := sha256.Sum256([]byte(content + "\x00" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (im *Importer) userID(nickname string) (int, error) {
+	if id, ok := im.users[nickname]; ok {
+		return id, nil
+	}
+
+	user, err := models.CreateOrUpdateUser(im.db, nickname)
+	if err != nil {
+		return 0, err
+	}
+	im.users[nickname] = user.ID
+	return user.ID, nil
+}
+
+func (im *Importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+
+	inserted, err := models.ImportMessages(im.db, im.batch)
+	if err != nil {
+		return err
+	}
+	im.stats.Imported += inserted
+	im.batch = im.batch[:0]
+	return nil
+}
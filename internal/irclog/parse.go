@@ -0,0 +1,359 @@
+// Package irclog reads the channel logs of common IRC clients and imports
+// them as channel history.
+package irclog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Format is a log format
+type Format string
+
+const (
+	FormatIrssi   Format = "irssi"
+	FormatWeechat Format = "weechat"
+	FormatZNC     Format = "znc"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{FormatIrssi, FormatWeechat, FormatZNC}
+
+// ParseFormat validates a format name
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == strings.ToLower(name) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log format %q", name)
+}
+
+// Entry is one line of a log that has a counterpart in channel history.
+// Event uses the names stored in messages.
+type Entry struct {
+	Time        time.Time
+	Event       string
+	Nickname    string // who the event is about, the kicked user for kicks
+	Message     string // text, part reason, kick reason or topic
+	IsPassive   bool   // actions (/me)
+	NewNickname string // nick changes
+	Actor       string // who kicked, for kicks
+}
+
+// ParseOptions controls how times in a log are read
+type ParseOptions struct {
+	// Location is the time zone the log was written in, UTC if nil
+	Location *time.Location
+	// Date is the day of logs whose lines carry only a time, like ZNC's
+	// daily files. irssi logs name the day themselves.
+	Date time.Time
+}
+
+// Parse reads a log and calls fn for every entry. Lines without a
+// counterpart in channel history, like mode changes or server notices, are
+// skipped and counted.
+func Parse(r io.Reader, format Format, opts ParseOptions, fn func(Entry) error) (skipped int, err error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	var p lineParser
+	switch format {
+	case FormatIrssi:
+		p = &irssiParser{opts: opts}
+	case FormatWeechat:
+		p = &weechatParser{opts: opts}
+	case FormatZNC:
+		if opts.Date.IsZero() {
+			return 0, fmt.Errorf("ZNC logs need the date of the log")
+		}
+		p = &zncParser{opts: opts}
+	default:
+		return 0, fmt.Errorf("unknown log format %q", format)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		entry, ok, err := p.parse(line)
+		if err != nil {
+			return skipped, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, scanner.Err()
+}
+
+type lineParser interface {
+	parse(line string) (Entry, bool, error)
+}
+
+// stripMode removes the channel mode prefix clients show before nicknames
+func stripMode(nickname string) string {
+	return strings.TrimLeft(nickname, " @+%&~")
+}
+
+// onDay combines a day with a clock time like "14:02" or "14:02:03"
+func onDay(day time.Time, clock string, loc *time.Location) (time.Time, error) {
+	layout := "15:04:05"
+	if len(clock) == len("15:04") {
+		layout = "15:04"
+	}
+	t, err := time.Parse(layout, clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", clock)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+}
+
+// chatEntry parses "<nick> text" and "* nick text" lines, which look the
+// same in irssi and ZNC logs
+func chatEntry(t time.Time, text string) (Entry, bool) {
+	if match := chatPattern.FindStringSubmatch(text); match != nil {
+		return Entry{Time: t, Event: "message", Nickname: stripMode(match[1]), Message: match[2]}, true
+	}
+	if match := actionPattern.FindStringSubmatch(text); match != nil {
+		return Entry{Time: t, Event: "message", Nickname: stripMode(match[1]), Message: match[2], IsPassive: true}, true
+	}
+	return Entry{}, false
+}
+
+var (
+	chatPattern   = regexp.MustCompile(`^<([^>]+)> ?(.*)$`)
+	actionPattern = regexp.MustCompile(`^ ?\* (\S+) ?(.*)$`)
+)
+
+func kickReason(reason string) string {
+	if reason == "" {
+		return "Kicked"
+	}
+	return reason
+}
+
+func topicText(topic string) string {
+	if topic == "" {
+		return "Topic cleared"
+	}
+	return topic
+}
+
+// irssiParser reads logs written with irssi's default theme:
+//
+//	--- Day changed Mon Oct 19 2026
+//	14:02 <@alice> hello
+//	14:03 -!- bob [~bob@host] has joined #ops
+type irssiParser struct {
+	opts ParseOptions
+	day  time.Time
+}
+
+var (
+	irssiLinePattern  = regexp.MustCompile(`^(\d{2}:\d{2}(?::\d{2})?) (.*)$`)
+	irssiJoinPattern  = regexp.MustCompile(`^-!- (\S+)(?: \[[^\]]*\])? has joined (\S+)$`)
+	irssiPartPattern  = regexp.MustCompile(`^-!- (\S+)(?: \[[^\]]*\])? has left (\S+)(?: \[(.*)\])?$`)
+	irssiQuitPattern  = regexp.MustCompile(`^-!- (\S+)(?: \[[^\]]*\])? has quit(?: \[(.*)\])?$`)
+	irssiNickPattern  = regexp.MustCompile(`^-!- (\S+) is now known as (\S+)$`)
+	irssiTopicPattern = regexp.MustCompile(`^-!- (\S+) changed the topic of (\S+) to: ?(.*)$`)
+	irssiKickPattern  = regexp.MustCompile(`^-!- (\S+) was kicked from (\S+) by (\S+)(?: \[(.*)\])?$`)
+)
+
+func (p *irssiParser) parse(line string) (Entry, bool, error) {
+	if rest, ok := strings.CutPrefix(line, "--- Log opened "); ok {
+		day, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", strings.Join(strings.Fields(rest), " "), p.opts.Location)
+		if err != nil {
+			return Entry{}, false, fmt.Errorf("invalid date %q", rest)
+		}
+		p.day = day
+		return Entry{}, false, nil
+	}
+	if rest, ok := strings.CutPrefix(line, "--- Day changed "); ok {
+		day, err := time.ParseInLocation("Mon Jan 2 2006", strings.Join(strings.Fields(rest), " "), p.opts.Location)
+		if err != nil {
+			return Entry{}, false, fmt.Errorf("invalid date %q", rest)
+		}
+		p.day = day
+		return Entry{}, false, nil
+	}
+
+	match := irssiLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return Entry{}, false, nil
+	}
+
+	day := p.day
+	if day.IsZero() {
+		day = p.opts.Date
+	}
+	if day.IsZero() {
+		return Entry{}, false, fmt.Errorf("no \"Log opened\" or \"Day changed\" line before the first message, the date of the log is needed")
+	}
+	t, err := onDay(day, match[1], p.opts.Location)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	text := match[2]
+	if entry, ok := chatEntry(t, text); ok {
+		return entry, true, nil
+	}
+
+	if m := irssiJoinPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "joined", Nickname: m[1]}, true, nil
+	}
+	if m := irssiPartPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "left", Nickname: m[1], Message: m[3]}, true, nil
+	}
+	if m := irssiQuitPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "left", Nickname: m[1], Message: m[2]}, true, nil
+	}
+	if m := irssiNickPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "nick_change", Nickname: m[1], NewNickname: m[2]}, true, nil
+	}
+	if m := irssiTopicPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "topic_change", Nickname: m[1], Message: topicText(m[3])}, true, nil
+	}
+	if m := irssiKickPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "kicked", Nickname: m[1], Message: kickReason(m[4]), Actor: m[3]}, true, nil
+	}
+	return Entry{}, false, nil
+}
+
+// weechatParser reads WeeChat's tab separated logs:
+//
+//	2026-10-18 14:02:03	@alice	hello
+//	2026-10-18 14:03:10	-->	bob (~bob@host) has joined #ops
+type weechatParser struct {
+	opts ParseOptions
+}
+
+var (
+	weechatJoinPattern  = regexp.MustCompile(`^(\S+)(?: \([^)]*\))? has joined (\S+)$`)
+	weechatPartPattern  = regexp.MustCompile(`^(\S+)(?: \([^)]*\))? has left (\S+)(?: \((.*)\))?$`)
+	weechatQuitPattern  = regexp.MustCompile(`^(\S+)(?: \([^)]*\))? has quit(?: \((.*)\))?$`)
+	weechatKickPattern  = regexp.MustCompile(`^(\S+) has kicked (\S+)(?: \((.*)\))?$`)
+	weechatNickPattern  = regexp.MustCompile(`^(\S+) is now known as (\S+)$`)
+	weechatTopicPattern = regexp.MustCompile(`^(\S+) has changed topic for (\S+)(?: from ".*")? to "(.*)"$`)
+	weechatUnsetPattern = regexp.MustCompile(`^(\S+) has unset topic for (\S+)$`)
+)
+
+func (p *weechatParser) parse(line string) (Entry, bool, error) {
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) != 3 {
+		return Entry{}, false, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateTime, fields[0], p.opts.Location)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("invalid time %q", fields[0])
+	}
+	prefix, text := strings.TrimSpace(fields[1]), fields[2]
+
+	switch prefix {
+	case "-->":
+		if m := weechatJoinPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "joined", Nickname: m[1]}, true, nil
+		}
+	case "<--":
+		if m := weechatPartPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "left", Nickname: m[1], Message: m[3]}, true, nil
+		}
+		if m := weechatQuitPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "left", Nickname: m[1], Message: m[2]}, true, nil
+		}
+		if m := weechatKickPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "kicked", Nickname: m[2], Message: kickReason(m[3]), Actor: m[1]}, true, nil
+		}
+	case "--":
+		if m := weechatNickPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "nick_change", Nickname: m[1], NewNickname: m[2]}, true, nil
+		}
+		if m := weechatTopicPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "topic_change", Nickname: m[1], Message: topicText(m[3])}, true, nil
+		}
+		if m := weechatUnsetPattern.FindStringSubmatch(text); m != nil {
+			return Entry{Time: t, Event: "topic_change", Nickname: m[1], Message: topicText("")}, true, nil
+		}
+	case "*":
+		nickname, action, _ := strings.Cut(text, " ")
+		return Entry{Time: t, Event: "message", Nickname: stripMode(nickname), Message: action, IsPassive: true}, true, nil
+	case "", "=!=":
+		// Server messages and errors
+	default:
+		return Entry{Time: t, Event: "message", Nickname: stripMode(prefix), Message: text}, true, nil
+	}
+	return Entry{}, false, nil
+}
+
+// zncParser reads the daily files of ZNC's log module:
+//
+//	[14:02:03] <alice> hello
+//	[14:03:10] *** Joins: bob (~bob@host)
+type zncParser struct {
+	opts ParseOptions
+}
+
+var (
+	zncLinePattern  = regexp.MustCompile(`^\[(\d{2}:\d{2}:\d{2})\] (.*)$`)
+	zncJoinPattern  = regexp.MustCompile(`^\*\*\* Joins: (\S+)(?: \([^)]*\))?$`)
+	zncPartPattern  = regexp.MustCompile(`^\*\*\* Parts: (\S+) \([^)]*\)(?: \((.*)\))?$`)
+	zncQuitPattern  = regexp.MustCompile(`^\*\*\* Quits: (\S+) \([^)]*\)(?: \((.*)\))?$`)
+	zncNickPattern  = regexp.MustCompile(`^\*\*\* (\S+) is now known as (\S+)$`)
+	zncTopicPattern = regexp.MustCompile(`^\*\*\* (\S+) changes topic to '(.*)'$`)
+	zncKickPattern  = regexp.MustCompile(`^\*\*\* (\S+) was kicked by (\S+)(?: \((.*)\))?$`)
+)
+
+func (p *zncParser) parse(line string) (Entry, bool, error) {
+	match := zncLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return Entry{}, false, nil
+	}
+
+	t, err := onDay(p.opts.Date, match[1], p.opts.Location)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	text := match[2]
+	if !strings.HasPrefix(text, "*** ") {
+		entry, ok := chatEntry(t, text)
+		return entry, ok, nil
+	}
+
+	if m := zncJoinPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "joined", Nickname: m[1]}, true, nil
+	}
+	if m := zncPartPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "left", Nickname: m[1], Message: m[2]}, true, nil
+	}
+	if m := zncQuitPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "left", Nickname: m[1], Message: m[2]}, true, nil
+	}
+	if m := zncNickPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "nick_change", Nickname: m[1], NewNickname: m[2]}, true, nil
+	}
+	if m := zncTopicPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "topic_change", Nickname: m[1], Message: topicText(m[2])}, true, nil
+	}
+	if m := zncKickPattern.FindStringSubmatch(text); m != nil {
+		return Entry{Time: t, Event: "kicked", Nickname: m[1], Message: kickReason(m[3]), Actor: m[2]}, true, nil
+	}
+	return Entry{}, false, nil
+}
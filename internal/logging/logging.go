@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Config describes how the server logs
+type Config struct {
+	Format        string // "text" or "json"
+	Level         string // "debug", "info", "warn" or "error"
+	RedactContent bool   // replace message bodies with their length
+}
+
+var redactContent atomic.Bool
+
+// Setup builds a logger from the config and installs it as the default for
+// both log/slog and the standard log package.
+func Setup(w io.Writer, cfg Config) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	redactContent.Store(cfg.RedactContent)
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// ParseLevel converts a level name into a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Content returns a log attribute for user supplied text such as message
+// bodies. With redaction enabled only the length is logged.
+func Content(text string) slog.Attr {
+	if redactContent.Load() {
+		return slog.Int("content_length", len(text))
+	}
+	return slog.String("content", text)
+}
@@ -0,0 +1,50 @@
+// Package markdown renders chat messages. Messages are parsed once when they
+// are stored, into HTML that is safe to insert into a page as is and a plain
+// text version for clients and notifications that don't show HTML.
+package markdown
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// md matches how the web client rendered messages before the server did:
+// GitHub flavored, with line breaks kept. Raw HTML is never passed through,
+// the sanitizer shows it as text.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(sanitizer{}, 1000)),
+	),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// Rendered is a message rendered for display
+type Rendered struct {
+	HTML  string
+	Plain string
+}
+
+// Render renders a message. It doesn't fail, the worst a message can do is
+// render as text.
+func Render(message string) Rendered {
+	source := []byte(message)
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, source, doc); err != nil {
+		// Only writing can fail, which a buffer doesn't
+		return Rendered{HTML: string(util.EscapeHTML(source)), Plain: message}
+	}
+	return Rendered{
+		HTML:  strings.TrimSpace(buf.String()),
+		Plain: plainText(doc, source),
+	}
+}
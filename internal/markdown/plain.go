@@ -0,0 +1,111 @@
+package markdown
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// plainText writes out what a reader sees of a message: the text without
+// its markup, one line per block. Link targets follow their text unless the
+// text is the target.
+func plainText(doc ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	writeBlocks(&buf, doc, source)
+	return strings.TrimSpace(buf.String())
+}
+
+func writeBlocks(buf *bytes.Buffer, parent ast.Node, source []byte) {
+	for node := parent.FirstChild(); node != nil; node = node.NextSibling() {
+		if node.PreviousSibling() != nil {
+			buf.WriteByte('\n')
+		}
+		switch n := node.(type) {
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				buf.Write(line.Value(source))
+			}
+			trimNewline(buf)
+		case *ast.ListItem:
+			if list, ok := n.Parent().(*ast.List); ok {
+				if list.IsOrdered() {
+					buf.WriteString(strconv.Itoa(list.Start+itemIndex(n)) + ". ")
+				} else {
+					buf.WriteString("- ")
+				}
+			}
+			writeBlocks(buf, n, source)
+		case *ast.ThematicBreak:
+			buf.WriteString("---")
+		case *east.TableRow, *east.TableHeader:
+			for cell := n.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				if cell.PreviousSibling() != nil {
+					buf.WriteString(" | ")
+				}
+				writeInline(buf, cell, source)
+			}
+		default:
+			if n.Type() == ast.TypeBlock && n.HasChildren() && n.FirstChild().Type() == ast.TypeBlock {
+				writeBlocks(buf, n, source)
+			} else {
+				writeInline(buf, n, source)
+			}
+		}
+	}
+}
+
+func writeInline(buf *bytes.Buffer, parent ast.Node, source []byte) {
+	for node := parent.FirstChild(); node != nil; node = node.NextSibling() {
+		switch n := node.(type) {
+		case *ast.Text:
+			value := n.Segment.Value(source)
+			if !n.IsRaw() {
+				value = util.UnescapePunctuations(util.ResolveEntityNames(util.ResolveNumericReferences(value)))
+			}
+			buf.Write(value)
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte('\n')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		case *ast.AutoLink:
+			buf.Write(n.Label(source))
+		case *ast.Link:
+			start := buf.Len()
+			writeInline(buf, n, source)
+			if label := buf.Bytes()[start:]; !bytes.Equal(label, n.Destination) &&
+				!bytes.Equal(label, bytes.TrimPrefix(n.Destination, []byte("mailto:"))) {
+				buf.WriteString(" (" + string(n.Destination) + ")")
+			}
+		case *east.TaskCheckBox:
+			if n.IsChecked {
+				buf.WriteString("[x] ")
+			} else {
+				buf.WriteString("[ ] ")
+			}
+		default:
+			writeInline(buf, n, source)
+		}
+	}
+}
+
+// itemIndex returns the position of an item in its list
+func itemIndex(item ast.Node) int {
+	index := 0
+	for node := item.PreviousSibling(); node != nil; node = node.PreviousSibling() {
+		index++
+	}
+	return index
+}
+
+func trimNewline(buf *bytes.Buffer) {
+	if b := buf.Bytes(); len(b) > 0 && b[len(b)-1] == '\n' {
+		buf.Truncate(len(b) - 1)
+	}
+}
@@ -0,0 +1,148 @@
+package markdown
+
+import (
+	"net/url"
+	"slices"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// linkRel is set on every link, they all lead off the chat
+const linkRel = "nofollow noopener noreferrer"
+
+// linkSchemes are the schemes links may have. Images are only linked to, so
+// they are limited to the web.
+var (
+	linkSchemes  = []string{"http", "https", "mailto"}
+	imageSchemes = []string{"http", "https"}
+)
+
+// sanitizer rewrites the parsed message so that rendering it can't produce
+// anything but formatting and links:
+//   - raw HTML is shown as the text that was typed
+//   - links with other schemes than linkSchemes are shown as their text
+//   - images become links to the image, so that reading a message doesn't
+//     make the browser fetch from wherever the sender chose
+type sanitizer struct{}
+
+func (sanitizer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+
+	// Nodes are replaced after the walk, replacing them during it would
+	// lose the walk's place
+	var nodes []ast.Node
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node.(type) {
+		case *ast.RawHTML, *ast.HTMLBlock, *ast.Link, *ast.AutoLink, *ast.Image:
+			nodes = append(nodes, node)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *ast.RawHTML:
+			var raw []byte
+			for i := 0; i < n.Segments.Len(); i++ {
+				segment := n.Segments.At(i)
+				raw = append(raw, segment.Value(source)...)
+			}
+			replace(n, ast.NewString(raw))
+		case *ast.HTMLBlock:
+			replace(n, htmlBlockText(n, source))
+		case *ast.Link:
+			if !allowedURL(n.Destination, linkSchemes) {
+				unwrap(n)
+				continue
+			}
+			n.SetAttributeString("rel", []byte(linkRel))
+			n.SetAttributeString("target", []byte("_blank"))
+		case *ast.AutoLink:
+			if !allowedURL(n.URL(source), linkSchemes) {
+				replace(n, ast.NewString(n.Label(source)))
+				continue
+			}
+			n.SetAttributeString("rel", []byte(linkRel))
+			n.SetAttributeString("target", []byte("_blank"))
+		case *ast.Image:
+			// Images in links are shown as their text, links can't nest
+			if !allowedURL(n.Destination, imageSchemes) || insideLink(n) {
+				unwrap(n)
+				continue
+			}
+			link := ast.NewLink()
+			link.Destination = n.Destination
+			link.Title = n.Title
+			link.SetAttributeString("rel", []byte(linkRel))
+			link.SetAttributeString("target", []byte("_blank"))
+			moveChildren(n, link)
+			replace(n, link)
+		}
+	}
+}
+
+// allowedURL reports whether a URL is absolute with one of the schemes
+func allowedURL(link []byte, schemes []string) bool {
+	parsed, err := url.Parse(string(link))
+	if err != nil {
+		return false
+	}
+	return slices.Contains(schemes, parsed.Scheme)
+}
+
+func insideLink(node ast.Node) bool {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if _, ok := parent.(*ast.Link); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlBlockText turns a block of HTML into a paragraph of its lines
+func htmlBlockText(block *ast.HTMLBlock, source []byte) ast.Node {
+	paragraph := ast.NewParagraph()
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		appendLine(paragraph, lines.At(i), source)
+	}
+	if block.HasClosure() {
+		appendLine(paragraph, block.ClosureLine, source)
+	}
+	return paragraph
+}
+
+func appendLine(paragraph *ast.Paragraph, line text.Segment, source []byte) {
+	if last, ok := paragraph.LastChild().(*ast.Text); ok {
+		last.SetSoftLineBreak(true)
+	}
+	paragraph.AppendChild(paragraph, ast.NewTextSegment(line.TrimRightSpace(source)))
+}
+
+func replace(old, replacement ast.Node) {
+	old.Parent().ReplaceChild(old.Parent(), old, replacement)
+}
+
+// unwrap replaces a node with its children
+func unwrap(node ast.Node) {
+	parent := node.Parent()
+	for child := node.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		parent.InsertBefore(parent, node, child)
+		child = next
+	}
+	parent.RemoveChild(parent, node)
+}
+
+func moveChildren(from, to ast.Node) {
+	for child := from.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		to.AppendChild(to, child)
+		child = next
+	}
+}
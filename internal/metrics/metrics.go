@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds all server metrics. A dedicated registry keeps the
+// exposition free of anything third party packages might register globally.
+var Registry = prometheus.NewRegistry()
+
+var (
+	CommandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tbchat_commands_total",
+		Help: "WebSocket commands handled, by command.",
+	}, []string{"command"})
+
+	CommandErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tbchat_command_errors_total",
+		Help: "WebSocket commands that were answered with an error, by command.",
+	}, []string{"command"})
+
+	CommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tbchat_command_duration_seconds",
+		Help:    "Time spent handling WebSocket commands, by command.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command"})
+
+	BroadcastFanout = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tbchat_broadcast_fanout_sessions",
+		Help:    "Number of sessions a broadcast was delivered to.",
+		Buckets: []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+	})
+
+	BroadcastSendFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tbchat_broadcast_send_failures_total",
+		Help: "Broadcast messages that could not be written to a session.",
+	})
+
+	HeartbeatExpirations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tbchat_heartbeat_expirations_total",
+		Help: "Sessions expired because no heartbeat arrived in time.",
+	})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tbchat_db_query_duration_seconds",
+		Help:    "SQLite statement latency, by connection pool and operation.",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1},
+	}, []string{"pool", "op"})
+
+	// TLSCertificateExpiry is registered once the server has a certificate,
+	// so plain HTTP deployments don't report an expiry of 0
+	TLSCertificateExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tbchat_tls_certificate_expiry_timestamp_seconds",
+		Help: "When the served TLS certificate expires, as a Unix timestamp.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		CommandsTotal,
+		CommandErrorsTotal,
+		CommandDuration,
+		BroadcastFanout,
+		BroadcastSendFailures,
+		HeartbeatExpirations,
+		DBQueryDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
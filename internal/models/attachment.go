@@ -0,0 +1,160 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// MaxMessageAttachments is how many attachments one message can carry
+const MaxMessageAttachments = 10
+
+// Attachment is an uploaded file. MessageID and ChannelID are set once it
+// was sent with a message.
+type Attachment struct {
+	ID          int       `json:"id" db:"id"`
+	Token       string    `json:"-" db:"token"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	SHA256      string    `json:"sha256" db:"sha256"`
+	MessageID   *int      `json:"message_id" db:"message_id"`
+	ChannelID   *int      `json:"channel_id" db:"channel_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+const attachmentColumns = `id, token, user_id, filename, content_type, size, sha256, message_id, channel_id, created_at`
+
+// CreateAttachment records an upload of a stored file with a fresh random
+// token
+func CreateAttachment(database *db.DB, userID int, filename, contentType, sha256 string, size int64) (*Attachment, error) {
+	token := rand.Text()
+
+	result, err := database.WriteDB().Exec(
+		"INSERT INTO attachments (token, user_id, filename, content_type, size, sha256) VALUES (?, ?, ?, ?, ?, ?)",
+		token, userID, filename, contentType, size, sha256,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Attachment{
+		ID:          int(id),
+		Token:       token,
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      sha256,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// GetAttachmentByToken returns an attachment, or nil if there is none with
+// the token
+func GetAttachmentByToken(database *db.DB, token string) (*Attachment, error) {
+	var attachment Attachment
+	err := database.ReadDBX().Get(&attachment, "SELECT "+attachmentColumns+" FROM attachments WHERE token = ?", token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// CountUnsentAttachments returns how many of the given attachments a user
+// uploaded and has not sent yet
+func CountUnsentAttachments(database *db.DB, userID int, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(ids))[1:]
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	var count int
+	err := database.ReadDBX().Get(&count,
+		"SELECT COUNT(*) FROM attachments WHERE user_id = ? AND message_id IS NULL AND id IN ("+placeholders+")", args...)
+	return count, err
+}
+
+// AttachToMessage sends a user's unsent attachments with a message. It
+// returns how many were attached; others were sent before or aren't theirs.
+func AttachToMessage(database *db.DB, userID int, ids []int, messageID, channelID int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(ids))[1:]
+	args := []interface{}{messageID, channelID, userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	result, err := database.WriteDB().Exec(
+		"UPDATE attachments SET message_id = ?, channel_id = ? WHERE user_id = ? AND message_id IS NULL AND id IN ("+placeholders+")",
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// GetMessageAttachments returns the attachments of messages in upload
+// order, by message ID
+func GetMessageAttachments(database *db.DB, messageIDs []int) (map[int][]*Attachment, error) {
+	attachments := make(map[int][]*Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(messageIDs))[1:]
+	args := make([]interface{}, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	var rows []*Attachment
+	err := database.ReadDBX().Select(&rows,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE message_id IN ("+placeholders+") ORDER BY message_id, id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		attachments[*row.MessageID] = append(attachments[*row.MessageID], row)
+	}
+	return attachments, nil
+}
+
+// GetAttachmentHashes returns the hashes of all files attachments refer to
+func GetAttachmentHashes(database *db.DB) (map[string]bool, error) {
+	var hashes []string
+	if err := database.ReadDBX().Select(&hashes, "SELECT DISTINCT sha256 FROM attachments"); err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		set[hash] = true
+	}
+	return set, nil
+}
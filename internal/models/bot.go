@@ -0,0 +1,240 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// ErrNicknameTaken is returned when creating a bot with a nickname that
+// already belongs to a user
+var ErrNicknameTaken = errors.New("nickname is already taken")
+
+// Bot is a user that authenticates with a token. Empty allow lists permit
+// every channel and command.
+type Bot struct {
+	UserID          int        `json:"user_id"`
+	Nickname        string     `json:"nickname"`
+	AllowedChannels []string   `json:"allowed_channels"`
+	AllowedCommands []string   `json:"allowed_commands"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+}
+
+type botRow struct {
+	UserID          int          `db:"user_id"`
+	Nickname        string       `db:"nickname"`
+	AllowedChannels string       `db:"allowed_channels"`
+	AllowedCommands string       `db:"allowed_commands"`
+	CreatedAt       time.Time    `db:"created_at"`
+	LastSeenAt      sql.NullTime `db:"last_seen_at"`
+}
+
+func (row *botRow) bot() *Bot {
+	bot := &Bot{
+		UserID:          row.UserID,
+		Nickname:        row.Nickname,
+		AllowedChannels: splitAllowList(row.AllowedChannels),
+		AllowedCommands: splitAllowList(row.AllowedCommands),
+		CreatedAt:       row.CreatedAt,
+	}
+	if row.LastSeenAt.Valid {
+		bot.LastSeenAt = &row.LastSeenAt.Time
+	}
+	return bot
+}
+
+const botColumns = `b.user_id, u.nickname, b.allowed_channels, b.allowed_commands, b.created_at, b.last_seen_at`
+
+func splitAllowList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizeBotChannels normalizes channel names so they can be compared with
+// the names stored on channels
+func normalizeBotChannels(channels []string) ([]string, error) {
+	normalized := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if err := ValidateChannelName(channel); err != nil {
+			return nil, fmt.Errorf("invalid channel %q: %w", channel, err)
+		}
+		normalized = append(normalized, NormalizeChannelName(channel))
+	}
+	return normalized, nil
+}
+
+func normalizeBotCommands(commands []string) ([]string, error) {
+	normalized := make([]string, 0, len(commands))
+	for _, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" || strings.Contains(command, ",") {
+			return nil, fmt.Errorf("invalid command %q", command)
+		}
+		normalized = append(normalized, command)
+	}
+	return normalized, nil
+}
+
+// hashBotToken returns the form a bot token is stored in
+func hashBotToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateBot creates a bot user and returns it together with its token. The
+// token is not stored and cannot be retrieved later.
+func CreateBot(database *db.DB, nickname string, channels, commands []string) (*Bot, string, error) {
+	channels, err := normalizeBotChannels(channels)
+	if err != nil {
+		return nil, "", err
+	}
+	commands, err = normalizeBotCommands(commands)
+	if err != nil {
+		return nil, "", err
+	}
+
+	existing, err := GetUserByNickname(database, nickname)
+	if err != nil {
+		return nil, "", err
+	}
+	if existing != nil {
+		return nil, "", ErrNicknameTaken
+	}
+
+	tx, err := database.WriteDB().Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO users (nickname, is_serv, is_bot) VALUES (?, FALSE, TRUE)", nickname)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create bot user: %w", err)
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user ID: %w", err)
+	}
+
+	token := rand.Text() + rand.Text()
+	_, err = tx.Exec(
+		"INSERT INTO bots (user_id, token_hash, allowed_channels, allowed_commands) VALUES (?, ?, ?, ?)",
+		userID, hashBotToken(token), strings.Join(channels, ","), strings.Join(commands, ","),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create bot: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+
+	bot, err := GetBotByUserID(database, int(userID))
+	return bot, token, err
+}
+
+func GetBotByUserID(database *db.DB, userID int) (*Bot, error) {
+	var row botRow
+	err := database.ReadDBX().Get(&row, "SELECT "+botColumns+" FROM bots b JOIN users u ON u.id = b.user_id WHERE b.user_id = ?", userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return row.bot(), nil
+}
+
+// GetBotByToken looks up the bot a token belongs to
+func GetBotByToken(database *db.DB, token string) (*Bot, error) {
+	var row botRow
+	err := database.ReadDBX().Get(&row, "SELECT "+botColumns+" FROM bots b JOIN users u ON u.id = b.user_id WHERE b.token_hash = ?", hashBotToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return row.bot(), nil
+}
+
+// GetBots returns all bots ordered by nickname
+func GetBots(database *db.DB) ([]*Bot, error) {
+	var rows []botRow
+	err := database.ReadDBX().Select(&rows, "SELECT "+botColumns+" FROM bots b JOIN users u ON u.id = b.user_id ORDER BY u.nickname")
+	if err != nil {
+		return nil, err
+	}
+
+	bots := make([]*Bot, 0, len(rows))
+	for i := range rows {
+		bots = append(bots, rows[i].bot())
+	}
+	return bots, nil
+}
+
+// SetBotRestrictions replaces the channel and command allow lists of a bot
+func SetBotRestrictions(database *db.DB, userID int, channels, commands []string) error {
+	channels, err := normalizeBotChannels(channels)
+	if err != nil {
+		return err
+	}
+	commands, err = normalizeBotCommands(commands)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.WriteDB().Exec(
+		"UPDATE bots SET allowed_channels = ?, allowed_commands = ? WHERE user_id = ?",
+		strings.Join(channels, ","), strings.Join(commands, ","), userID,
+	)
+	return err
+}
+
+// RotateBotToken replaces the token of a bot and returns the new one
+func RotateBotToken(database *db.DB, userID int) (string, error) {
+	token := rand.Text() + rand.Text()
+	_, err := database.WriteDB().Exec("UPDATE bots SET token_hash = ? WHERE user_id = ?", hashBotToken(token), userID)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// TouchBot records that a bot just connected
+func TouchBot(database *db.DB, userID int) error {
+	_, err := database.WriteDB().Exec("UPDATE bots SET last_seen_at = CURRENT_TIMESTAMP WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteBot removes the bot's token and turns the account back into a
+// regular user, which keeps its message history intact
+func DeleteBot(database *db.DB, userID int) error {
+	tx, err := database.WriteDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM bots WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET is_bot = FALSE WHERE id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,14 +3,20 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"throwback-chat/internal/db"
 )
 
+// ErrChannelNameTaken is returned when renaming a channel to an existing name
+var ErrChannelNameTaken = errors.New("channel name is already taken")
+
 type Channel struct {
-	ID    int    `json:"id" db:"id"`
-	Name  string `json:"name" db:"name"`
-	Topic string `json:"topic" db:"topic"`
+	ID        int    `json:"id" db:"id"`
+	Name      string `json:"name" db:"name"`
+	Topic     string `json:"topic" db:"topic"`
+	IsSecret  bool   `json:"is_secret" db:"is_secret"`
+	IsPrivate bool   `json:"is_private" db:"is_private"`
 }
 
 // NormalizeChannelName ensures channel names start with '#' and are lowercase
@@ -30,6 +36,9 @@ func NormalizeChannelName(name string) string {
 	return name
 }
 
+// MaxChannelNameLength is the longest channel name allowed, including the #
+const MaxChannelNameLength = 50
+
 // ValidateChannelName checks if a channel name is valid
 func ValidateChannelName(name string) error {
 	if name == "" {
@@ -44,8 +53,8 @@ func ValidateChannelName(name string) error {
 		return errors.New("channel name must be at least 1 character long")
 	}
 
-	if len(normalized) > 50 {
-		return errors.New("channel name cannot exceed 49 characters")
+	if len(normalized) > MaxChannelNameLength {
+		return fmt.Errorf("channel name cannot exceed %d characters", MaxChannelNameLength-1)
 	}
 
 	// Check for valid characters (alphanumeric, dash, underscore, and # at start)
@@ -68,7 +77,7 @@ func GetChannelByName(database *db.DB, name string) (*Channel, error) {
 	normalizedName := NormalizeChannelName(name)
 
 	var channel Channel
-	err := database.ReadDBX().Get(&channel, "SELECT id, name, topic FROM channels WHERE name = ?", normalizedName)
+	err := database.ReadDBX().Get(&channel, "SELECT id, name, topic, is_secret, is_private FROM channels WHERE name = ?", normalizedName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -80,7 +89,7 @@ func GetChannelByName(database *db.DB, name string) (*Channel, error) {
 
 func GetChannelByID(database *db.DB, id int) (*Channel, error) {
 	var channel Channel
-	err := database.ReadDBX().Get(&channel, "SELECT id, name, topic FROM channels WHERE id = ?", id)
+	err := database.ReadDBX().Get(&channel, "SELECT id, name, topic, is_secret, is_private FROM channels WHERE id = ?", id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -138,7 +147,7 @@ func IsChannelEmpty(database *db.DB, channelID int) (bool, error) {
 			SELECT user_id, channel_id,
 				   SUM(CASE WHEN event = 'joined' THEN 1 ELSE -1 END) as balance
 			FROM messages
-			WHERE channel_id = ? AND event IN ('joined', 'left')
+			WHERE channel_id = ? AND event IN ('joined', 'left') AND import_key IS NULL
 			GROUP BY user_id, channel_id
 		) user_status ON ops.user_id = user_status.user_id AND ops.channel_id = user_status.channel_id
 		WHERE ops.channel_id = ? 
@@ -175,6 +184,12 @@ func IsUserOp(database *db.DB, userID, channelID int) (bool, error) {
 	return count > 0, err
 }
 
+// SetChannelModes updates the secret and private flags of a channel
+func SetChannelModes(database *db.DB, channelID int, isSecret, isPrivate bool) error {
+	_, err := database.WriteDB().Exec("UPDATE channels SET is_secret = ?, is_private = ? WHERE id = ?", isSecret, isPrivate, channelID)
+	return err
+}
+
 func UpdateChannelTopic(database *db.DB, channelID int, topic string) error {
 	_, err := database.WriteDB().Exec("UPDATE channels SET topic = ? WHERE id = ?", topic, channelID)
 	return err
@@ -185,12 +200,12 @@ func GetChannelUserCount(database *db.DB, channelID int) (int, error) {
 	// Count the balance of join/leave events to determine current user count
 	var joinCount, leaveCount int
 
-	err := database.ReadDBX().Get(&joinCount, "SELECT COUNT(*) FROM messages WHERE channel_id = ? AND event = 'joined'", channelID)
+	err := database.ReadDBX().Get(&joinCount, "SELECT COUNT(*) FROM messages WHERE channel_id = ? AND event = 'joined' AND import_key IS NULL", channelID)
 	if err != nil {
 		return 0, err
 	}
 
-	err = database.ReadDBX().Get(&leaveCount, "SELECT COUNT(*) FROM messages WHERE channel_id = ? AND event = 'left'", channelID)
+	err = database.ReadDBX().Get(&leaveCount, "SELECT COUNT(*) FROM messages WHERE channel_id = ? AND event = 'left' AND import_key IS NULL", channelID)
 	if err != nil {
 		return 0, err
 	}
@@ -203,10 +218,26 @@ func GetChannelUserCount(database *db.DB, channelID int) (int, error) {
 	return userCount, nil
 }
 
+// CountChannels returns the number of existing channels
+func CountChannels(database *db.DB) (int, error) {
+	var count int
+	err := database.ReadDBX().Get(&count, "SELECT COUNT(*) FROM channels")
+	return count, err
+}
+
+// GetAllChannels returns all channels ordered by name
+func GetAllChannels(database *db.DB) ([]Channel, error) {
+	var channels []Channel
+	err := database.ReadDBX().Select(&channels, "SELECT id, name, topic, is_secret, is_private FROM channels ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
 // GetAllChannelsWithInfo returns all channels with their user counts
 func GetAllChannelsWithInfo(database *db.DB) ([]ChannelInfo, error) {
-	var channels []Channel
-	err := database.ReadDBX().Select(&channels, "SELECT id, name, topic FROM channels ORDER BY name")
+	channels, err := GetAllChannels(database)
 	if err != nil {
 		return nil, err
 	}
@@ -223,6 +254,8 @@ func GetAllChannelsWithInfo(database *db.DB) ([]ChannelInfo, error) {
 			Name:      channel.Name,
 			Topic:     channel.Topic,
 			UserCount: userCount,
+			IsSecret:  channel.IsSecret,
+			IsPrivate: channel.IsPrivate,
 		})
 	}
 
@@ -236,7 +269,7 @@ func GetUserChannels(database *db.DB, userID int) ([]ChannelInfo, error) {
 		SELECT DISTINCT c.id, c.name, c.topic
 		FROM channels c
 		JOIN messages m ON c.id = m.channel_id
-		WHERE m.user_id = ? AND m.event IN ('joined', 'left')
+		WHERE m.user_id = ? AND m.event IN ('joined', 'left') AND m.import_key IS NULL
 		GROUP BY c.id, c.name, c.topic
 		HAVING SUM(CASE WHEN m.event = 'joined' THEN 1 ELSE -1 END) > 0
 		ORDER BY c.name
@@ -266,43 +299,131 @@ func GetUserChannels(database *db.DB, userID int) ([]ChannelInfo, error) {
 	return channelInfos, nil
 }
 
-// DeleteEmptyChannel removes a channel if it has no users
+// DeleteEmptyChannel removes a channel if it has no users. Channels with
+// webhooks are kept so that the webhook URLs stay valid, and channels with
+// imported history so that it isn't lost.
 func DeleteEmptyChannel(database *db.DB, channelID int) error {
 	userCount, err := GetChannelUserCount(database, channelID)
 	if err != nil {
 		return err
 	}
 
-	if userCount == 0 {
-		// Delete channel and all associated data
-		tx, err := database.WriteDB().Begin()
-		if err != nil {
-			return err
-		}
-		defer tx.Rollback()
+	var webhookCount int
+	err = database.ReadDBX().Get(&webhookCount,
+		"SELECT (SELECT COUNT(*) FROM webhooks WHERE channel_id = ?) + (SELECT COUNT(*) FROM outgoing_webhooks WHERE channel_id = ?)",
+		channelID, channelID,
+	)
+	if err != nil {
+		return err
+	}
 
-		// Delete ops first (foreign key constraint)
-		_, err = tx.Exec("DELETE FROM ops WHERE channel_id = ?", channelID)
-		if err != nil {
-			return err
-		}
+	var imported bool
+	err = database.ReadDBX().Get(&imported,
+		"SELECT EXISTS (SELECT 1 FROM messages WHERE channel_id = ? AND import_key IS NOT NULL)", channelID)
+	if err != nil {
+		return err
+	}
 
-		// Delete messages
-		_, err = tx.Exec("DELETE FROM messages WHERE channel_id = ?", channelID)
-		if err != nil {
-			return err
-		}
+	if userCount == 0 && webhookCount == 0 && !imported {
+		return DeleteChannel(database, channelID)
+	}
 
-		// Delete channel
-		_, err = tx.Exec("DELETE FROM channels WHERE id = ?", channelID)
-		if err != nil {
-			return err
-		}
+	return nil
+}
+
+// DeleteChannel removes a channel and all associated data regardless of
+// whether anyone is still in it
+func DeleteChannel(database *db.DB, channelID int) error {
+	tx, err := database.WriteDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-		return tx.Commit()
+	// Delete ops first (foreign key constraint)
+	_, err = tx.Exec("DELETE FROM ops WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// Delete incoming and outgoing webhooks of the channel
+	_, err = tx.Exec("DELETE FROM webhooks WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM outgoing_webhooks WHERE channel_id = ?)", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM outgoing_webhooks WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+
+	// Delete read markers, pins, attachments, link previews, mentions,
+	// reactions and messages. Files of the attachments stay on disk until
+	// pruned, previews stay cached for other messages with the same links.
+	_, err = tx.Exec("DELETE FROM read_markers WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM message_previews WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM attachments WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM pins WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM reactions WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM mentions WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM messages WHERE channel_id = ?", channelID)
+	if err != nil {
+		return err
+	}
+
+	// Delete channel
+	_, err = tx.Exec("DELETE FROM channels WHERE id = ?", channelID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RenameChannel changes a channel's name. Returns ErrChannelNameTaken if
+// another channel already uses the normalized name.
+func RenameChannel(database *db.DB, channelID int, name string) (string, error) {
+	if err := ValidateChannelName(name); err != nil {
+		return "", err
+	}
+
+	normalizedName := NormalizeChannelName(name)
+
+	existing, err := GetChannelByName(database, normalizedName)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil && existing.ID != channelID {
+		return "", ErrChannelNameTaken
+	}
+
+	_, err = database.WriteDB().Exec("UPDATE channels SET name = ? WHERE id = ?", normalizedName, channelID)
+	if err != nil {
+		return "", err
+	}
+
+	return normalizedName, nil
 }
 
 // ChannelInfo represents channel information with user count
@@ -311,6 +432,8 @@ type ChannelInfo struct {
 	Name      string `json:"name"`
 	Topic     string `json:"topic"`
 	UserCount int    `json:"user_count"`
+	IsSecret  bool   `json:"is_secret,omitempty"`
+	IsPrivate bool   `json:"is_private,omitempty"`
 }
 
 // ChannelUser represents a user in a channel with their status
@@ -318,6 +441,7 @@ type ChannelUser struct {
 	ID       int    `json:"id" db:"id"`
 	Nickname string `json:"nickname" db:"nickname"`
 	IsServ   bool   `json:"is_serv" db:"is_serv"`
+	IsBot    bool   `json:"is_bot" db:"is_bot"`
 	IsOp     bool   `json:"is_op" db:"is_op"`
 }
 
@@ -325,13 +449,13 @@ type ChannelUser struct {
 func GetChannelUsers(database *db.DB, channelID int) ([]ChannelUser, error) {
 	// Get users who have more joins than leaves in this channel
 	query := `
-		SELECT DISTINCT u.id, u.nickname, u.is_serv,
+		SELECT DISTINCT u.id, u.nickname, u.is_serv, u.is_bot,
 		       COALESCE(ops.user_id IS NOT NULL, 0) as is_op
 		FROM users u
 		JOIN messages m ON u.id = m.user_id
 		LEFT JOIN ops ON u.id = ops.user_id AND ops.channel_id = ?
-		WHERE m.channel_id = ? AND m.event IN ('joined', 'left')
-		GROUP BY u.id, u.nickname, u.is_serv
+		WHERE m.channel_id = ? AND m.event IN ('joined', 'left') AND m.import_key IS NULL
+		GROUP BY u.id, u.nickname, u.is_serv, u.is_bot
 		HAVING SUM(CASE WHEN m.event = 'joined' THEN 1 ELSE -1 END) > 0
 		ORDER BY 
 		    COALESCE(ops.user_id IS NOT NULL, 0) DESC,  -- Ops first
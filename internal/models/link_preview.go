@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// LinkPreview is what a URL's page says about itself. OK is false for URLs
+// that could not be previewed, which are cached as well.
+type LinkPreview struct {
+	URL         string    `json:"url" db:"url"`
+	Title       string    `json:"title,omitempty" db:"title"`
+	Description string    `json:"description,omitempty" db:"description"`
+	Image       string    `json:"image,omitempty" db:"image"`
+	SiteName    string    `json:"site_name,omitempty" db:"site_name"`
+	OK          bool      `json:"-" db:"ok"`
+	FetchedAt   time.Time `json:"-" db:"fetched_at"`
+}
+
+// GetLinkPreview returns the cached preview of a URL, or nil if it was never
+// fetched
+func GetLinkPreview(database *db.DB, url string) (*LinkPreview, error) {
+	var preview LinkPreview
+	err := database.ReadDBX().Get(&preview,
+		"SELECT url, title, description, image, site_name, ok, fetched_at FROM link_previews WHERE url = ?", url)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// SaveLinkPreview caches the preview of a URL, replacing an older one
+func SaveLinkPreview(database *db.DB, preview *LinkPreview) error {
+	_, err := database.WriteDB().Exec(`
+		INSERT INTO link_previews (url, title, description, image, site_name, ok)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET
+			title = excluded.title, description = excluded.description, image = excluded.image,
+			site_name = excluded.site_name, ok = excluded.ok, fetched_at = CURRENT_TIMESTAMP`,
+		preview.URL, preview.Title, preview.Description, preview.Image, preview.SiteName, preview.OK,
+	)
+	return err
+}
+
+// AddMessagePreview records that a message has the preview of a URL at a
+// position
+func AddMessagePreview(database *db.DB, messageID, channelID int, url string, position int) error {
+	_, err := database.WriteDB().Exec(
+		"INSERT OR IGNORE INTO message_previews (message_id, url, channel_id, position) VALUES (?, ?, ?, ?)",
+		messageID, url, channelID, position,
+	)
+	return err
+}
+
+// GetMessagePreviews returns the previews of messages in the order their
+// URLs appeared, by message ID
+func GetMessagePreviews(database *db.DB, messageIDs []int) (map[int][]LinkPreview, error) {
+	previews := make(map[int][]LinkPreview)
+	if len(messageIDs) == 0 {
+		return previews, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(messageIDs))[1:]
+	args := make([]interface{}, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	var rows []struct {
+		MessageID int `db:"message_id"`
+		LinkPreview
+	}
+	err := database.ReadDBX().Select(&rows, `
+		SELECT mp.message_id, lp.url, lp.title, lp.description, lp.image, lp.site_name, lp.ok, lp.fetched_at
+		FROM message_previews mp
+		JOIN link_previews lp ON lp.url = mp.url
+		WHERE mp.message_id IN (`+placeholders+`) AND lp.ok
+		ORDER BY mp.message_id, mp.position`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		previews[row.MessageID] = append(previews[row.MessageID], row.LinkPreview)
+	}
+	return previews, nil
+}
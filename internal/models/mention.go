@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// Mention is a message that named a user or matched one of their highlight
+// words
+type Mention struct {
+	ID          int       `json:"id" db:"id"`
+	MessageID   int       `json:"message_id" db:"message_id"`
+	ChannelID   int       `json:"channel_id" db:"channel_id"`
+	ChannelName string    `json:"channel_name" db:"channel_name"`
+	UserID      int       `json:"user_id" db:"user_id"` // who sent the message
+	Nickname    string    `json:"nickname" db:"nickname"`
+	Message     string    `json:"message" db:"message"`
+	IsPassive   bool      `json:"is_passive" db:"is_passive"`
+	SentAt      time.Time `json:"sent_at" db:"sent_at"`
+	Seen        bool      `json:"seen" db:"seen"`
+
+	// Renderings of the message, see Message
+	HTML  string `json:"html,omitempty" db:"html"`
+	Plain string `json:"plain,omitempty" db:"plain"`
+}
+
+// HighlightTarget is a user who may be mentioned by a message in a channel
+type HighlightTarget struct {
+	UserID     int    `db:"id"`
+	Highlights string `db:"highlights"`
+}
+
+// Words returns the user's highlight words
+func (t HighlightTarget) Words() []string {
+	return splitAllowList(t.Highlights)
+}
+
+// MentionOptions selects a page of a user's mentions
+type MentionOptions struct {
+	Limit      int
+	Before     *int // mentions older than this mention ID
+	UnseenOnly bool
+}
+
+// GetHighlightTargets returns the members of a channel that have highlight
+// words, using the same notion of membership as GetChannelUsers
+func GetHighlightTargets(database *db.DB, channelID int) ([]HighlightTarget, error) {
+	var targets []HighlightTarget
+	err := database.ReadDBX().Select(&targets, `
+		SELECT u.id, u.highlights
+		FROM users u
+		JOIN messages m ON u.id = m.user_id
+		WHERE m.channel_id = ? AND m.event IN ('joined', 'left') AND m.import_key IS NULL
+		  AND u.highlights != ''
+		GROUP BY u.id, u.highlights
+		HAVING SUM(CASE WHEN m.event = 'joined' THEN 1 ELSE -1 END) > 0`,
+		channelID,
+	)
+	return targets, err
+}
+
+// GetUserHighlights returns a user's highlight words
+func GetUserHighlights(database *db.DB, userID int) ([]string, error) {
+	var highlights string
+	err := database.ReadDBX().Get(&highlights, "SELECT highlights FROM users WHERE id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	return splitAllowList(highlights), nil
+}
+
+// SetUserHighlights replaces a user's highlight words. The words are
+// expected to be normalized already.
+func SetUserHighlights(database *db.DB, userID int, words []string) error {
+	_, err := database.WriteDB().Exec("UPDATE users SET highlights = ? WHERE id = ?", strings.Join(words, ","), userID)
+	return err
+}
+
+// CreateMention records that a message mentions a user. It returns the
+// mention ID, or 0 if the mention was already recorded.
+func CreateMention(database *db.DB, userID, messageID, channelID int) (int, error) {
+	result, err := database.WriteDB().Exec(
+		"INSERT OR IGNORE INTO mentions (user_id, message_id, channel_id) VALUES (?, ?, ?)",
+		userID, messageID, channelID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetMentions returns a user's mentions, newest first. The limit may exceed
+// MaxHistoryLimit by one, for callers that look ahead to find out whether
+// there are more mentions.
+func GetMentions(database *db.DB, userID int, options MentionOptions) ([]*Mention, error) {
+	if options.Limit <= 0 || options.Limit > MaxHistoryLimit+1 {
+		options.Limit = 50
+	}
+
+	query := `SELECT mn.id, mn.message_id, mn.channel_id, c.name AS channel_name, m.user_id, m.nickname,
+	                 m.message, m.is_passive, m.sent_at, mn.seen, m.html, m.plain
+	          FROM mentions mn
+	          JOIN messages m ON m.id = mn.message_id
+	          JOIN channels c ON c.id = mn.channel_id
+	          WHERE mn.user_id = ?`
+	args := []interface{}{userID}
+
+	if options.Before != nil {
+		query += " AND mn.id < ?"
+		args = append(args, *options.Before)
+	}
+	if options.UnseenOnly {
+		query += " AND NOT mn.seen"
+	}
+	query += " ORDER BY mn.id DESC LIMIT ?"
+	args = append(args, options.Limit)
+
+	mentions := []*Mention{}
+	err := database.ReadDBX().Select(&mentions, query, args...)
+	return mentions, err
+}
+
+// MarkMentionsSeen marks mentions of a user as seen. IDs of other users'
+// mentions are ignored.
+func MarkMentionsSeen(database *db.DB, userID int, mentionIDs []int) error {
+	if len(mentionIDs) == 0 {
+		return nil
+	}
+
+	placeholders := strings.Repeat(",?", len(mentionIDs))[1:]
+	args := []interface{}{userID}
+	for _, id := range mentionIDs {
+		args = append(args, id)
+	}
+
+	_, err := database.WriteDB().Exec(
+		"UPDATE mentions SET seen = TRUE WHERE user_id = ? AND id IN ("+placeholders+")", args...)
+	return err
+}
+
+// FindMentionedMember returns the ID of the member of a channel an
+// @nickname refers to, ignoring case, or 0 if there is none. Membership is
+// the same as in GetChannelUsers. Service users can't be mentioned.
+func FindMentionedMember(database *db.DB, channelID int, nickname string) (int, error) {
+	var id int
+	err := database.ReadDBX().Get(&id, `
+		SELECT u.id
+		FROM users u
+		JOIN messages m ON u.id = m.user_id
+		WHERE m.channel_id = ? AND m.event IN ('joined', 'left') AND m.import_key IS NULL
+		  AND u.nickname = ? COLLATE NOCASE AND NOT u.is_serv
+		GROUP BY u.id
+		HAVING SUM(CASE WHEN m.event = 'joined' THEN 1 ELSE -1 END) > 0
+		ORDER BY u.id LIMIT 1`,
+		channelID, nickname,
+	)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"database/sql"
 	"throwback-chat/internal/db"
+	"throwback-chat/internal/markdown"
 	"time"
 )
 
@@ -14,13 +16,36 @@ type Message struct {
 	IsPassive bool      `json:"is_passive" db:"is_passive"`
 	Event     string    `json:"event" db:"event"`
 	Nickname  string    `json:"nickname" db:"nickname"`
+
+	// Set on thread replies, which only show in the channel if broadcast
+	ReplyTo        *int `json:"reply_to,omitempty" db:"reply_to"`
+	ReplyBroadcast bool `json:"reply_broadcast,omitempty" db:"reply_broadcast"`
+
+	// Chat messages are rendered when they are stored, other events leave
+	// these empty
+	HTML  string `json:"html,omitempty" db:"html"`
+	Plain string `json:"plain,omitempty" db:"plain"`
+
+	// Set on events another user caused, like kicks
+	ActorID       *int   `json:"actor_id,omitempty" db:"actor_id"`
+	ActorNickname string `json:"actor_nickname,omitempty" db:"actor_nickname"`
+}
+
+// renderMessage renders the text of chat messages
+func renderMessage(event, message string) markdown.Rendered {
+	if event != "message" {
+		return markdown.Rendered{}
+	}
+	return markdown.Render(message)
 }
 
 func CreateMessage(database *db.DB, channelID *int, userID int, message, event, nickname string, isPassive bool) (*Message, error) {
-	query := `INSERT INTO messages (channel_id, user_id, message, event, nickname, is_passive) 
-			  VALUES (?, ?, ?, ?, ?, ?)`
+	rendered := renderMessage(event, message)
+	query := `INSERT INTO messages (channel_id, user_id, message, event, nickname, is_passive, html, plain) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := database.WriteDB().Exec(query, channelID, userID, message, event, nickname, isPassive)
+	result, err := database.WriteDB().Exec(query, channelID, userID, message, event, nickname, isPassive,
+		rendered.HTML, rendered.Plain)
 	if err != nil {
 		return nil, err
 	}
@@ -39,15 +64,46 @@ func CreateMessage(database *db.DB, channelID *int, userID int, message, event,
 		IsPassive: isPassive,
 		Event:     event,
 		Nickname:  nickname,
+		HTML:      rendered.HTML,
+		Plain:     rendered.Plain,
+	}, nil
+}
+
+// CreateActorEvent stores an event that another user caused, like a kick
+func CreateActorEvent(database *db.DB, channelID, userID int, message, event, nickname string, actorID int, actorNickname string) (*Message, error) {
+	result, err := database.WriteDB().Exec(`INSERT INTO messages
+		(channel_id, user_id, message, event, nickname, is_passive, actor_id, actor_nickname)
+		VALUES (?, ?, ?, ?, ?, FALSE, ?, ?)`,
+		channelID, userID, message, event, nickname, actorID, actorNickname,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ID:            int(id),
+		ChannelID:     &channelID,
+		UserID:        userID,
+		SentAt:        time.Now(),
+		Message:       message,
+		Event:         event,
+		Nickname:      nickname,
+		ActorID:       &actorID,
+		ActorNickname: actorNickname,
 	}, nil
 }
 
 func GetRecentMessages(database *db.DB, channelID int, limit int) ([]*Message, error) {
 	var messages []*Message
-	query := `SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname
+	query := `SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname, html, plain, actor_id, actor_nickname
 			  FROM messages 
 			  WHERE channel_id = ? 
-			  ORDER BY sent_at DESC 
+			  ORDER BY sent_at DESC, id DESC
 			  LIMIT ?`
 
 	err := database.ReadDBX().Select(&messages, query, channelID, limit)
@@ -61,39 +117,50 @@ type MessageHistoryOptions struct {
 	After  *int // Get messages after this message ID
 }
 
-// GetMessageHistory retrieves messages with pagination support
+// MaxHistoryLimit is the most messages GetMessageHistory returns at once
+const MaxHistoryLimit = 500
+
+// GetMessageHistory retrieves messages with pagination support. Thread
+// replies are left out unless they were broadcast to the channel.
 func GetMessageHistory(database *db.DB, channelID int, options MessageHistoryOptions) ([]*Message, error) {
 	var messages []*Message
 	var query string
 	var args []interface{}
 
 	// Default limit
-	if options.Limit <= 0 || options.Limit > 500 {
+	if options.Limit <= 0 || options.Limit > MaxHistoryLimit {
 		options.Limit = 100
 	}
 
 	// Base query
-	baseQuery := `SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname
+	baseQuery := `SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname,
+				         reply_to, reply_broadcast, html, plain, actor_id, actor_nickname
 				  FROM messages 
-				  WHERE channel_id = ?`
+				  WHERE channel_id = ? AND (reply_to IS NULL OR reply_broadcast)`
 	args = append(args, channelID)
 
+	// Imported history makes IDs disagree with time, so messages are ordered
+	// by (sent_at, id) and cursors compare against the cursor message's
+	// position in that order
+	const beforeCursor = ` AND (sent_at, id) < (SELECT sent_at, id FROM messages WHERE id = ?)`
+	const afterCursor = ` AND (sent_at, id) > (SELECT sent_at, id FROM messages WHERE id = ?)`
+
 	// Add pagination conditions
 	if options.Before != nil && options.After != nil {
 		// Get messages between two IDs
-		query = baseQuery + ` AND id > ? AND id < ? ORDER BY sent_at DESC LIMIT ?`
+		query = baseQuery + afterCursor + beforeCursor + ` ORDER BY sent_at DESC, id DESC LIMIT ?`
 		args = append(args, *options.After, *options.Before, options.Limit)
 	} else if options.Before != nil {
 		// Get messages before a specific ID
-		query = baseQuery + ` AND id < ? ORDER BY sent_at DESC LIMIT ?`
+		query = baseQuery + beforeCursor + ` ORDER BY sent_at DESC, id DESC LIMIT ?`
 		args = append(args, *options.Before, options.Limit)
 	} else if options.After != nil {
 		// Get messages after a specific ID
-		query = baseQuery + ` AND id > ? ORDER BY sent_at ASC LIMIT ?`
+		query = baseQuery + afterCursor + ` ORDER BY sent_at ASC, id ASC LIMIT ?`
 		args = append(args, *options.After, options.Limit)
 	} else {
 		// Get most recent messages (default behavior)
-		query = baseQuery + ` ORDER BY id DESC LIMIT ?`
+		query = baseQuery + ` ORDER BY sent_at DESC, id DESC LIMIT ?`
 		args = append(args, options.Limit)
 	}
 
@@ -109,3 +176,116 @@ func GetMessageHistory(database *db.DB, channelID int, options MessageHistoryOpt
 
 	return messages, err
 }
+
+// sqliteTimeFormat is how SQLite's CURRENT_TIMESTAMP stores times (in UTC)
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// ForEachMessageInRange calls fn for every message of a channel sent in
+// [from, to), oldest first. Zero times leave that end of the range open.
+// Messages are streamed from the database, so long ranges don't have to fit
+// in memory.
+func ForEachMessageInRange(database *db.DB, channelID int, from, to time.Time, fn func(*Message) error) error {
+	query := `SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname,
+			         reply_to, reply_broadcast, html, plain, actor_id, actor_nickname
+			  FROM messages
+			  WHERE channel_id = ?`
+	args := []interface{}{channelID}
+
+	if !from.IsZero() {
+		query += ` AND sent_at >= ?`
+		args = append(args, from.UTC().Format(sqliteTimeFormat))
+	}
+	if !to.IsZero() {
+		query += ` AND sent_at < ?`
+		args = append(args, to.UTC().Format(sqliteTimeFormat))
+	}
+	query += ` ORDER BY sent_at ASC, id ASC`
+
+	rows, err := database.ReadDBX().Queryx(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message Message
+		if err := rows.StructScan(&message); err != nil {
+			return err
+		}
+		if err := fn(&message); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportedMessage is a message from an imported IRC log. ImportKey
+// identifies it across imports.
+type ImportedMessage struct {
+	ChannelID int
+	UserID    int
+	SentAt    time.Time
+	Message   string
+	IsPassive bool
+	Event     string
+	Nickname  string
+	ImportKey string
+
+	// Who caused the event, for kicks
+	ActorID       *int
+	ActorNickname string
+}
+
+// ImportMessages inserts imported messages in one transaction, skipping
+// those that were imported before. It returns how many were new.
+func ImportMessages(database *db.DB, messages []ImportedMessage) (int, error) {
+	tx, err := database.WriteDB().Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO messages
+		(channel_id, user_id, sent_at, message, is_passive, event, nickname, import_key, html, plain,
+		 actor_id, actor_nickname)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, m := range messages {
+		rendered := renderMessage(m.Event, m.Message)
+		result, err := stmt.Exec(m.ChannelID, m.UserID, m.SentAt.UTC().Format(sqliteTimeFormat),
+			m.Message, m.IsPassive, m.Event, m.Nickname, m.ImportKey, rendered.HTML, rendered.Plain,
+			m.ActorID, m.ActorNickname)
+		if err != nil {
+			return 0, err
+		}
+		if rows, err := result.RowsAffected(); err == nil {
+			inserted += int(rows)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// GetMessageByID returns a message, or nil if it doesn't exist
+func GetMessageByID(database *db.DB, id int) (*Message, error) {
+	var message Message
+	err := database.ReadDBX().Get(&message,
+		`SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname, reply_to, reply_broadcast,
+		        html, plain, actor_id, actor_nickname
+		 FROM messages WHERE id = ?`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &message, nil
+}
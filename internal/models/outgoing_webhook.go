@@ -0,0 +1,166 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// Match types narrowing down which messages trigger an outgoing webhook
+const (
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+)
+
+// maxDeliveriesPerWebhook is how many delivery log entries are kept per
+// outgoing webhook
+const maxDeliveriesPerWebhook = 100
+
+// OutgoingWebhook POSTs channel events to a URL. Secret is the HMAC key the
+// payloads are signed with.
+type OutgoingWebhook struct {
+	ID              int       `json:"id" db:"id"`
+	ChannelID       int       `json:"channel_id" db:"channel_id"`
+	URL             string    `json:"url" db:"url"`
+	Secret          string    `json:"secret" db:"secret"`
+	Event           string    `json:"event" db:"event"`
+	MatchType       string    `json:"match_type,omitempty" db:"match_type"`
+	Pattern         string    `json:"pattern,omitempty" db:"pattern"`
+	PostResponse    bool      `json:"post_response" db:"post_response"`
+	Nickname        string    `json:"nickname" db:"nickname"`
+	CreatedByUserID int       `json:"created_by_user_id" db:"created_by_user_id"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery records a single attempt to deliver an event
+type WebhookDelivery struct {
+	ID          int       `json:"id" db:"id"`
+	WebhookID   int       `json:"webhook_id" db:"webhook_id"`
+	MessageID   int       `json:"message_id" db:"message_id"`
+	Event       string    `json:"event" db:"event"`
+	Attempt     int       `json:"attempt" db:"attempt"`
+	StatusCode  int       `json:"status_code" db:"status_code"`
+	Error       string    `json:"error,omitempty" db:"error"`
+	DurationMS  int64     `json:"duration_ms" db:"duration_ms"`
+	DeliveredAt time.Time `json:"delivered_at" db:"delivered_at"`
+}
+
+const outgoingWebhookColumns = `id, channel_id, url, secret, event, match_type, pattern, post_response,
+	nickname, created_by_user_id, created_at`
+
+// CreateOutgoingWebhook stores a new outgoing webhook with a fresh random
+// secret
+func CreateOutgoingWebhook(database *db.DB, hook *OutgoingWebhook) (*OutgoingWebhook, error) {
+	result, err := database.WriteDB().Exec(
+		`INSERT INTO outgoing_webhooks (channel_id, url, secret, event, match_type, pattern, post_response, nickname, created_by_user_id)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hook.ChannelID, hook.URL, rand.Text(), hook.Event, hook.MatchType, hook.Pattern, hook.PostResponse, hook.Nickname, hook.CreatedByUserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetOutgoingWebhookByID(database, int(id))
+}
+
+func GetOutgoingWebhookByID(database *db.DB, id int) (*OutgoingWebhook, error) {
+	var hook OutgoingWebhook
+	err := database.ReadDBX().Get(&hook, "SELECT "+outgoingWebhookColumns+" FROM outgoing_webhooks WHERE id = ?", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// GetChannelOutgoingWebhooks returns all outgoing webhooks of a channel,
+// oldest first
+func GetChannelOutgoingWebhooks(database *db.DB, channelID int) ([]OutgoingWebhook, error) {
+	hooks := []OutgoingWebhook{}
+	err := database.ReadDBX().Select(&hooks,
+		"SELECT "+outgoingWebhookColumns+" FROM outgoing_webhooks WHERE channel_id = ? ORDER BY id",
+		channelID,
+	)
+	return hooks, err
+}
+
+// GetOutgoingWebhooksForEvent returns the outgoing webhooks of a channel that
+// fire on the given event
+func GetOutgoingWebhooksForEvent(database *db.DB, channelID int, event string) ([]OutgoingWebhook, error) {
+	var hooks []OutgoingWebhook
+	err := database.ReadDBX().Select(&hooks,
+		"SELECT "+outgoingWebhookColumns+" FROM outgoing_webhooks WHERE channel_id = ? AND event = ? ORDER BY id",
+		channelID, event,
+	)
+	return hooks, err
+}
+
+// DeleteOutgoingWebhook removes an outgoing webhook and its delivery log
+func DeleteOutgoingWebhook(database *db.DB, id int) error {
+	tx, err := database.WriteDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM outgoing_webhooks WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordWebhookDelivery adds an entry to the delivery log, dropping the oldest
+// entries of the webhook beyond the retention limit
+func RecordWebhookDelivery(database *db.DB, delivery *WebhookDelivery) error {
+	tx, err := database.WriteDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO webhook_deliveries (webhook_id, message_id, event, attempt, status_code, error, duration_ms)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		delivery.WebhookID, delivery.MessageID, delivery.Event, delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.DurationMS,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND id NOT IN (
+			SELECT id FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?
+		)`,
+		delivery.WebhookID, delivery.WebhookID, maxDeliveriesPerWebhook,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWebhookDeliveries returns the most recent delivery attempts of an
+// outgoing webhook, newest first
+func GetWebhookDeliveries(database *db.DB, webhookID, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	err := database.ReadDBX().Select(&deliveries,
+		`SELECT id, webhook_id, message_id, event, attempt, status_code, error, duration_ms, delivered_at
+		 FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`,
+		webhookID, limit,
+	)
+	return deliveries, err
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// MaxPins is how many messages a channel can have pinned
+const MaxPins = 50
+
+// Pin is a pinned message of a channel
+type Pin struct {
+	MessageID        int       `json:"message_id" db:"message_id"`
+	ChannelID        int       `json:"channel_id" db:"channel_id"`
+	UserID           int       `json:"user_id" db:"user_id"` // who sent the message
+	Nickname         string    `json:"nickname" db:"nickname"`
+	Message          string    `json:"message" db:"message"`
+	IsPassive        bool      `json:"is_passive" db:"is_passive"`
+	SentAt           time.Time `json:"sent_at" db:"sent_at"`
+	PinnedBy         int       `json:"pinned_by" db:"pinned_by"`
+	PinnedByNickname string    `json:"pinned_by_nickname" db:"pinned_by_nickname"`
+	PinnedAt         time.Time `json:"pinned_at" db:"pinned_at"`
+
+	// Renderings of the message, see Message
+	HTML  string `json:"html,omitempty" db:"html"`
+	Plain string `json:"plain,omitempty" db:"plain"`
+}
+
+const pinQuery = `SELECT p.message_id, p.channel_id, m.user_id, m.nickname, m.message, m.is_passive, m.sent_at,
+                         m.html, m.plain, p.pinned_by, u.nickname AS pinned_by_nickname, p.pinned_at
+                  FROM pins p
+                  JOIN messages m ON m.id = p.message_id
+                  JOIN users u ON u.id = p.pinned_by`
+
+// PinMessage pins a message of a channel. It reports false if the message
+// was pinned already.
+func PinMessage(database *db.DB, channelID, messageID, pinnedBy int) (bool, error) {
+	result, err := database.WriteDB().Exec(
+		"INSERT OR IGNORE INTO pins (channel_id, message_id, pinned_by) VALUES (?, ?, ?)",
+		channelID, messageID, pinnedBy,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// UnpinMessage unpins a message. It reports false if it wasn't pinned.
+func UnpinMessage(database *db.DB, channelID, messageID int) (bool, error) {
+	result, err := database.WriteDB().Exec(
+		"DELETE FROM pins WHERE channel_id = ? AND message_id = ?", channelID, messageID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CountPins returns how many messages of a channel are pinned
+func CountPins(database *db.DB, channelID int) (int, error) {
+	var count int
+	err := database.ReadDBX().Get(&count, "SELECT COUNT(*) FROM pins WHERE channel_id = ?", channelID)
+	return count, err
+}
+
+// GetPin returns a pinned message, or nil if it isn't pinned
+func GetPin(database *db.DB, channelID, messageID int) (*Pin, error) {
+	var pin Pin
+	err := database.ReadDBX().Get(&pin, pinQuery+" WHERE p.channel_id = ? AND p.message_id = ?", channelID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// GetPins returns the pinned messages of a channel in the order they were
+// pinned
+func GetPins(database *db.DB, channelID int) ([]*Pin, error) {
+	pins := []*Pin{}
+	err := database.ReadDBX().Select(&pins, pinQuery+" WHERE p.channel_id = ? ORDER BY p.pinned_at, p.rowid", channelID)
+	return pins, err
+}
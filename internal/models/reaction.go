@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+
+	"throwback-chat/internal/db"
+)
+
+// ReactionSummary aggregates the reactions with one emoji on a message
+type ReactionSummary struct {
+	MessageID int    `json:"-" db:"message_id"`
+	Emoji     string `json:"emoji" db:"emoji"`
+	Count     int    `json:"count" db:"count"`
+	Me        bool   `json:"me" db:"me"` // whether the requesting user reacted
+}
+
+// AddReaction adds a user's reaction to a message. It reports false if the
+// user had already reacted with the emoji.
+func AddReaction(database *db.DB, messageID, channelID, userID int, emoji string) (bool, error) {
+	result, err := database.WriteDB().Exec(
+		"INSERT OR IGNORE INTO reactions (message_id, user_id, emoji, channel_id) VALUES (?, ?, ?, ?)",
+		messageID, userID, emoji, channelID,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RemoveReaction removes a user's reaction. It reports false if there was
+// none.
+func RemoveReaction(database *db.DB, messageID, userID int, emoji string) (bool, error) {
+	result, err := database.WriteDB().Exec(
+		"DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji = ?",
+		messageID, userID, emoji,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CountReactions returns how many users reacted to a message with an emoji
+func CountReactions(database *db.DB, messageID int, emoji string) (int, error) {
+	var count int
+	err := database.ReadDBX().Get(&count,
+		"SELECT COUNT(*) FROM reactions WHERE message_id = ? AND emoji = ?", messageID, emoji)
+	return count, err
+}
+
+// CountReactionEmoji returns how many different emoji a message has
+func CountReactionEmoji(database *db.DB, messageID int) (int, error) {
+	var count int
+	err := database.ReadDBX().Get(&count,
+		"SELECT COUNT(DISTINCT emoji) FROM reactions WHERE message_id = ?", messageID)
+	return count, err
+}
+
+// GetReactions aggregates the reactions on messages, in the order the emoji
+// were first used. Me is set for emoji userID reacted with.
+func GetReactions(database *db.DB, messageIDs []int, userID int) (map[int][]ReactionSummary, error) {
+	reactions := make(map[int][]ReactionSummary)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(messageIDs))[1:]
+	args := []interface{}{userID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	var rows []ReactionSummary
+	err := database.ReadDBX().Select(&rows, `
+		SELECT message_id, emoji, COUNT(*) AS count, MAX(user_id = ?) AS me
+		FROM reactions
+		WHERE message_id IN (`+placeholders+`)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at), MIN(rowid)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		reactions[row.MessageID] = append(reactions[row.MessageID], row)
+	}
+	return reactions, nil
+}
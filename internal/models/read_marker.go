@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+
+	"throwback-chat/internal/db"
+)
+
+// UnreadState is where a user stopped reading a channel and what came after
+type UnreadState struct {
+	LastRead int `json:"last_read" db:"last_read"` // ID of the last message read, 0 if none
+	Unread   int `json:"unread" db:"unread"`       // messages by others after it
+	Mentions int `json:"mentions" db:"mentions"`   // unread messages mentioning the user
+}
+
+// InitReadMarker puts a user's marker at the latest message of a channel
+// unless they already have one, so joining doesn't make the whole history
+// unread while a rejoin shows what was missed
+func InitReadMarker(database *db.DB, userID, channelID int) error {
+	_, err := database.WriteDB().Exec(`
+		INSERT OR IGNORE INTO read_markers (user_id, channel_id, message_id)
+		VALUES (?, ?, (SELECT COALESCE(MAX(id), 0) FROM messages WHERE channel_id = ?))`,
+		userID, channelID, channelID,
+	)
+	return err
+}
+
+// MarkRead moves a user's marker forward to messageID. It reports false if
+// the marker already was at or past it.
+func MarkRead(database *db.DB, userID, channelID, messageID int) (bool, error) {
+	result, err := database.WriteDB().Exec(`
+		INSERT INTO read_markers (user_id, channel_id, message_id) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, channel_id) DO UPDATE
+		SET message_id = excluded.message_id, updated_at = CURRENT_TIMESTAMP
+		WHERE excluded.message_id > read_markers.message_id`,
+		userID, channelID, messageID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetLatestMessageID returns the ID of the newest message in a channel, 0 if
+// it has none
+func GetLatestMessageID(database *db.DB, channelID int) (int, error) {
+	var id int
+	err := database.ReadDBX().Get(&id, "SELECT COALESCE(MAX(id), 0) FROM messages WHERE channel_id = ?", channelID)
+	return id, err
+}
+
+// GetUnreadState counts the messages and mentions after a user's marker.
+// Only chat messages by others count, thread replies only if they were
+// broadcast to the channel. Without a marker nothing is unread.
+func GetUnreadState(database *db.DB, userID, channelID int) (UnreadState, error) {
+	var state UnreadState
+	err := database.ReadDBX().Get(&state, `
+		SELECT r.message_id AS last_read,
+		       (SELECT COUNT(*) FROM messages m
+		        WHERE m.channel_id = r.channel_id AND m.id > r.message_id
+		          AND m.event = 'message' AND m.user_id != r.user_id AND m.import_key IS NULL
+		          AND (m.reply_to IS NULL OR m.reply_broadcast)) AS unread,
+		       (SELECT COUNT(*) FROM mentions mn
+		        WHERE mn.user_id = r.user_id AND mn.channel_id = r.channel_id
+		          AND mn.message_id > r.message_id) AS mentions
+		FROM read_markers r
+		WHERE r.user_id = ? AND r.channel_id = ?`,
+		userID, channelID,
+	)
+	if err == sql.ErrNoRows {
+		return UnreadState{}, nil
+	}
+	return state, err
+}
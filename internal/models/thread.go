@@ -0,0 +1,118 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// ThreadSummary tells how many replies a message has and when the last one
+// was sent
+type ThreadSummary struct {
+	MessageID   int       `db:"message_id"`
+	ReplyCount  int       `db:"reply_count"`
+	LastReplyAt time.Time `db:"last_reply_at"`
+}
+
+// ThreadOptions selects a page of a thread's replies
+type ThreadOptions struct {
+	Limit int
+	After *int // replies after this reply ID
+}
+
+// CreateReply stores a chat message replying to the thread of parentID.
+// Broadcast replies also show in the channel's history.
+func CreateReply(database *db.DB, channelID, userID int, message, nickname string, isPassive bool, parentID int, broadcast bool) (*Message, error) {
+	rendered := renderMessage("message", message)
+	result, err := database.WriteDB().Exec(`INSERT INTO messages
+		(channel_id, user_id, message, event, nickname, is_passive, reply_to, reply_broadcast, html, plain)
+		VALUES (?, ?, ?, 'message', ?, ?, ?, ?, ?, ?)`,
+		channelID, userID, message, nickname, isPassive, parentID, broadcast, rendered.HTML, rendered.Plain,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ID:             int(id),
+		ChannelID:      &channelID,
+		UserID:         userID,
+		SentAt:         time.Now(),
+		Message:        message,
+		IsPassive:      isPassive,
+		Event:          "message",
+		Nickname:       nickname,
+		ReplyTo:        &parentID,
+		ReplyBroadcast: broadcast,
+		HTML:           rendered.HTML,
+		Plain:          rendered.Plain,
+	}, nil
+}
+
+// GetThreadSummaries returns the summaries of the messages that have
+// replies, by message ID
+func GetThreadSummaries(database *db.DB, messageIDs []int) (map[int]ThreadSummary, error) {
+	summaries := make(map[int]ThreadSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(messageIDs))[1:]
+	args := make([]interface{}, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	// The last reply is looked up by ID so its sent_at keeps the column's
+	// type, aggregates of it would come back as text
+	var rows []ThreadSummary
+	err := database.ReadDBX().Select(&rows, `
+		SELECT t.message_id, t.reply_count, m.sent_at AS last_reply_at
+		FROM (SELECT reply_to AS message_id, COUNT(*) AS reply_count, MAX(id) AS last_id
+		      FROM messages
+		      WHERE reply_to IN (`+placeholders+`)
+		      GROUP BY reply_to) t
+		JOIN messages m ON m.id = t.last_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		summaries[row.MessageID] = row
+	}
+	return summaries, nil
+}
+
+// GetThreadReplies returns a page of the replies to a message, oldest first.
+// The limit may exceed MaxHistoryLimit by one, for callers that look ahead to
+// find out whether there are more replies.
+func GetThreadReplies(database *db.DB, parentID int, options ThreadOptions) ([]*Message, error) {
+	if options.Limit <= 0 || options.Limit > MaxHistoryLimit+1 {
+		options.Limit = 100
+	}
+
+	query := `SELECT id, channel_id, user_id, sent_at, message, is_passive, event, nickname,
+	                 reply_to, reply_broadcast, html, plain, actor_id, actor_nickname
+	          FROM messages
+	          WHERE reply_to = ?`
+	args := []interface{}{parentID}
+
+	if options.After != nil {
+		query += ` AND (sent_at, id) > (SELECT sent_at, id FROM messages WHERE id = ?)`
+		args = append(args, *options.After)
+	}
+	query += ` ORDER BY sent_at ASC, id ASC LIMIT ?`
+	args = append(args, options.Limit)
+
+	replies := []*Message{}
+	err := database.ReadDBX().Select(&replies, query, args...)
+	return replies, err
+}
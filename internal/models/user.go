@@ -11,6 +11,7 @@ type User struct {
 	ID       int    `json:"id" db:"id"`
 	Nickname string `json:"nickname" db:"nickname"`
 	IsServ   bool   `json:"is_serv" db:"is_serv"`
+	IsBot    bool   `json:"is_bot" db:"is_bot"`
 }
 
 func CreateOrUpdateUser(database *db.DB, nickname string) (*User, error) {
@@ -40,7 +41,7 @@ func CreateOrUpdateUser(database *db.DB, nickname string) (*User, error) {
 
 func GetUserByNickname(database *db.DB, nickname string) (*User, error) {
 	var user User
-	err := database.ReadDBX().Get(&user, "SELECT id, nickname, is_serv FROM users WHERE nickname = ?", nickname)
+	err := database.ReadDBX().Get(&user, "SELECT id, nickname, is_serv, is_bot FROM users WHERE nickname = ?", nickname)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -52,6 +53,14 @@ func GetUserByNickname(database *db.DB, nickname string) (*User, error) {
 	return &user, nil
 }
 
+// NicknameTaken reports whether a user, service users included, has the
+// nickname, ignoring case
+func NicknameTaken(database *db.DB, nickname string) (bool, error) {
+	var count int
+	err := database.ReadDBX().Get(&count, "SELECT COUNT(*) FROM users WHERE nickname = ? COLLATE NOCASE", nickname)
+	return count > 0, err
+}
+
 func UpdateUserNickname(database *db.DB, userID int, newNickname string) error {
 	_, err := database.WriteDB().Exec("UPDATE users SET nickname = ? WHERE id = ?", newNickname, userID)
 	if err != nil {
@@ -59,3 +68,26 @@ func UpdateUserNickname(database *db.DB, userID int, newNickname string) error {
 	}
 	return nil
 }
+
+func GetUserByID(database *db.DB, userID int) (*User, error) {
+	var user User
+	err := database.ReadDBX().Get(&user, "SELECT id, nickname, is_serv, is_bot FROM users WHERE id = ?", userID)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// SetUserServ marks a user as a service user (or removes the mark)
+func SetUserServ(database *db.DB, userID int, isServ bool) error {
+	_, err := database.WriteDB().Exec("UPDATE users SET is_serv = ? WHERE id = ?", isServ, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"time"
+
+	"throwback-chat/internal/db"
+)
+
+// Webhook is an incoming webhook that posts into a channel. An empty
+// Nickname means the server wide default is used.
+type Webhook struct {
+	ID              int       `json:"id" db:"id"`
+	ChannelID       int       `json:"channel_id" db:"channel_id"`
+	Token           string    `json:"token" db:"token"`
+	Nickname        string    `json:"nickname" db:"nickname"`
+	CreatedByUserID int       `json:"created_by_user_id" db:"created_by_user_id"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// CreateWebhook creates a webhook for a channel with a fresh random token
+func CreateWebhook(database *db.DB, channelID, createdByUserID int, nickname string) (*Webhook, error) {
+	token := rand.Text()
+
+	result, err := database.WriteDB().Exec(
+		"INSERT INTO webhooks (channel_id, token, nickname, created_by_user_id) VALUES (?, ?, ?, ?)",
+		channelID, token, nickname, createdByUserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWebhookByID(database, int(id))
+}
+
+func GetWebhookByID(database *db.DB, id int) (*Webhook, error) {
+	var webhook Webhook
+	err := database.ReadDBX().Get(&webhook, "SELECT id, channel_id, token, nickname, created_by_user_id, created_at FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func GetWebhookByToken(database *db.DB, token string) (*Webhook, error) {
+	var webhook Webhook
+	err := database.ReadDBX().Get(&webhook, "SELECT id, channel_id, token, nickname, created_by_user_id, created_at FROM webhooks WHERE token = ?", token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetChannelWebhooks returns all webhooks of a channel, oldest first
+func GetChannelWebhooks(database *db.DB, channelID int) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := database.ReadDBX().Select(&webhooks,
+		"SELECT id, channel_id, token, nickname, created_by_user_id, created_at FROM webhooks WHERE channel_id = ? ORDER BY id",
+		channelID,
+	)
+	return webhooks, err
+}
+
+func DeleteWebhook(database *db.DB, id int) error {
+	_, err := database.WriteDB().Exec("DELETE FROM webhooks WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,107 @@
+// Package netguard keeps the requests the server makes on behalf of users,
+// like link previews and outgoing webhooks, away from internal addresses.
+// Addresses are checked when connecting, after name resolution, so names
+// that resolve to internal addresses and redirects to them are caught too.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned by Control for addresses it refuses
+var ErrBlockedAddress = errors.New("address is not public")
+
+// blockedPrefixes are not covered by the netip predicates but don't reach
+// the public internet either
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // this network
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, embeds IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local NAT64
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("2002::/16"),      // 6to4, embeds IPv4 addresses
+	netip.MustParsePrefix("2001::/32"),      // Teredo, embeds IPv4 addresses
+	netip.MustParsePrefix("fec0::/10"),      // deprecated site-local
+	netip.MustParsePrefix("100::/64"),       // discard
+	netip.MustParsePrefix("255.255.255.255/32"),
+}
+
+// PublicAddress reports whether an address is on the public internet
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Permitted reports whether an address is public or in one of the allowed
+// networks
+func Permitted(addr netip.Addr, allowed []netip.Prefix) bool {
+	if PublicAddress(addr) {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Control returns a net.Dialer Control hook that refuses connections to
+// addresses that aren't permitted. The allowed networks let operators reach
+// their own internal services.
+func Control(allowed []netip.Prefix) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return err
+		}
+		if !Permitted(addr, allowed) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+		}
+		return nil
+	}
+}
+
+// ParsePrefixes parses networks in CIDR notation. Single addresses stand
+// for themselves.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,115 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/netguard"
+)
+
+const (
+	fetchTimeout  = 8 * time.Second
+	dialTimeout   = 3 * time.Second
+	headerTimeout = 5 * time.Second
+	maxRedirects  = 3
+
+	// maxBodySize bounds how much of a page is read. Meta tags are in the
+	// head, which comes first.
+	maxBodySize = 512 << 10
+)
+
+// errNotPreviewable is returned for content that has nothing to preview
+var errNotPreviewable = errors.New("content can't be previewed")
+
+// Fetcher fetches pages for previews from public addresses only
+type Fetcher struct {
+	client *http.Client
+}
+
+func NewFetcher() *Fetcher {
+	dialer := &net.Dialer{Timeout: dialTimeout, Control: netguard.Control(nil)}
+	transport := &http.Transport{
+		// No proxy, it would dial the addresses for us
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   headerTimeout,
+		ResponseHeaderTimeout: headerTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &Fetcher{client: &http.Client{
+		Transport: transport,
+		Timeout:   fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to unsupported scheme")
+			}
+			return nil
+		},
+	}}
+}
+
+// Fetch builds the preview of a URL from the page's meta tags. Links to
+// images preview as the image.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "ThrowBackChat-LinkPreview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,image/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// Relative image URLs resolve against where redirects ended up
+	final := resp.Request.URL
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		meta := parseMeta(io.LimitReader(resp.Body, maxBodySize))
+		preview := meta.preview(rawURL, final)
+		if preview.Title == "" && preview.Description == "" {
+			return nil, errNotPreviewable
+		}
+		return preview, nil
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml":
+		return &models.LinkPreview{URL: rawURL, Image: final.String()}, nil
+	default:
+		return nil, errNotPreviewable
+	}
+}
+
+// resolveImage makes an image URL absolute, dropping anything that isn't a
+// web URL
+func resolveImage(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	image, err := base.Parse(ref)
+	if err != nil || (image.Scheme != "http" && image.Scheme != "https") || len(image.String()) > maxURLLength {
+		return ""
+	}
+	return image.String()
+}
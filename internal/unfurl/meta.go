@@ -0,0 +1,118 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"throwback-chat/internal/models"
+)
+
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+)
+
+// pageMeta holds the meta tags of a page that previews are made of, by
+// property or name
+type pageMeta struct {
+	title string // of the title element
+	tags  map[string]string
+}
+
+// parseMeta reads the head of a page. Tags in the body are ignored.
+func parseMeta(r io.Reader) pageMeta {
+	meta := pageMeta{tags: make(map[string]string)}
+	z := html.NewTokenizer(r)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head {
+				return meta
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				return meta
+			case atom.Title:
+				if meta.title == "" && z.Next() == html.TextToken {
+					meta.title = string(z.Text())
+				}
+			case atom.Meta:
+				if hasAttr {
+					meta.addTag(z)
+				}
+			}
+		}
+	}
+}
+
+// addTag records a meta tag's content under its property or name. The
+// first tag of each kind wins.
+func (m pageMeta) addTag(z *html.Tokenizer) {
+	var key, content string
+	for {
+		name, value, more := z.TagAttr()
+		switch string(name) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(value)))
+			}
+		case "content":
+			content = string(value)
+		}
+		if !more {
+			break
+		}
+	}
+
+	if key != "" && content != "" {
+		if _, seen := m.tags[key]; !seen {
+			m.tags[key] = content
+		}
+	}
+}
+
+// first returns the first of the tags that is set
+func (m pageMeta) first(keys ...string) string {
+	for _, key := range keys {
+		if value := m.tags[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// preview prefers OpenGraph over Twitter cards over plain HTML
+func (m pageMeta) preview(rawURL string, base *url.URL) *models.LinkPreview {
+	title := m.first("og:title", "twitter:title")
+	if title == "" {
+		title = m.title
+	}
+
+	return &models.LinkPreview{
+		URL:         rawURL,
+		Title:       clean(title, maxTitleLength),
+		Description: clean(m.first("og:description", "twitter:description", "description"), maxDescriptionLength),
+		Image:       resolveImage(base, strings.TrimSpace(m.first("og:image:secure_url", "og:image", "twitter:image", "twitter:image:src"))),
+		SiteName:    clean(m.first("og:site_name"), maxSiteNameLength),
+	}
+}
+
+// clean collapses whitespace and shortens text to at most limit runes
+func clean(text string, limit int) string {
+	text = strings.Join(strings.Fields(strings.ToValidUTF8(text, "")), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
@@ -0,0 +1,178 @@
+// Package unfurl builds previews of the links in chat messages. Pages are
+// fetched in the background, only from public addresses, and what they say
+// about themselves is cached in the database.
+package unfurl
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/models"
+)
+
+const (
+	// maxURLsPerMessage bounds the previews of one message
+	maxURLsPerMessage = 3
+
+	maxURLLength = 2048
+
+	// maxConcurrentFetches bounds the pages fetched at once server wide
+	maxConcurrentFetches = 8
+
+	// Cached previews are refetched after previewTTL, failures are retried
+	// after failureTTL
+	previewTTL = 24 * time.Hour
+	failureTTL = time.Hour
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// NotifyFunc passes on the previews of a message once they are stored
+type NotifyFunc func(msg *models.Message, previews []models.LinkPreview)
+
+// Unfurler previews the links of stored messages
+type Unfurler struct {
+	db      *db.DB
+	fetcher *Fetcher
+	notify  NotifyFunc
+	fetches chan struct{}
+}
+
+func NewUnfurler(database *db.DB, notify NotifyFunc) *Unfurler {
+	return &Unfurler{
+		db:      database,
+		fetcher: NewFetcher(),
+		notify:  notify,
+		fetches: make(chan struct{}, maxConcurrentFetches),
+	}
+}
+
+// Unfurl previews the links of a stored channel message in the background.
+// It is safe to call with a nil Unfurler or message, which do nothing.
+func (u *Unfurler) Unfurl(msg *models.Message) {
+	if u == nil || msg == nil || msg.ChannelID == nil {
+		return
+	}
+	urls := ExtractURLs(msg.Message)
+	if len(urls) == 0 {
+		return
+	}
+	go u.unfurl(msg, urls)
+}
+
+func (u *Unfurler) unfurl(msg *models.Message, urls []string) {
+	logger := slog.With("message_id", msg.ID, "channel_id", *msg.ChannelID)
+
+	var previews []models.LinkPreview
+	for position, link := range urls {
+		preview, err := u.preview(link)
+		if err != nil {
+			logger.Error("Failed to preview link", "error", err)
+			continue
+		}
+		if preview == nil {
+			continue
+		}
+		if err := models.AddMessagePreview(u.db, msg.ID, *msg.ChannelID, link, position); err != nil {
+			logger.Error("Failed to store link preview", "error", err)
+			continue
+		}
+		previews = append(previews, *preview)
+	}
+
+	if len(previews) > 0 {
+		u.notify(msg, previews)
+	}
+}
+
+// preview returns the cached preview of a URL, fetching it if there is no
+// fresh one, or nil if the URL can't be previewed
+func (u *Unfurler) preview(link string) (*models.LinkPreview, error) {
+	cached, err := models.GetLinkPreview(u.db, link)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		ttl := previewTTL
+		if !cached.OK {
+			ttl = failureTTL
+		}
+		if time.Since(cached.FetchedAt) < ttl {
+			if !cached.OK {
+				return nil, nil
+			}
+			return cached, nil
+		}
+	}
+
+	u.fetches <- struct{}{}
+	defer func() { <-u.fetches }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	preview, err := u.fetcher.Fetch(ctx, link)
+	if err != nil {
+		// Links are message content, which may be redacted from logs
+		slog.Debug("Link can't be previewed", "error", err)
+		preview = &models.LinkPreview{URL: link}
+	} else {
+		preview.OK = true
+	}
+
+	if err := models.SaveLinkPreview(u.db, preview); err != nil {
+		return nil, err
+	}
+	if !preview.OK {
+		return nil, nil
+	}
+	return preview, nil
+}
+
+// ExtractURLs returns the distinct web URLs in a text, up to three.
+// Punctuation after a URL is left out, closing parentheses only if the URL
+// doesn't open them, so that "(see https://example.com/a_(b))." works.
+func ExtractURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+
+	for _, match := range urlPattern.FindAllString(text, -1) {
+		match = trimURL(match)
+		if len(match) > maxURLLength || seen[match] {
+			continue
+		}
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Hostname() == "" || parsed.User != nil {
+			continue
+		}
+
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == maxURLsPerMessage {
+			break
+		}
+	}
+	return urls
+}
+
+func trimURL(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"*_~>", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+			link = link[:len(link)-1]
+		case last == ']' && strings.Count(link, "[") < strings.Count(link, "]"):
+			link = link[:len(link)-1]
+		default:
+			return link
+		}
+	}
+	return link
+}
@@ -2,7 +2,7 @@ package utils
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -23,13 +23,13 @@ func APIError(w http.ResponseWriter, code int, message string, err error) {
 
 // Respond with an HTTP error and log the error
 func InternalServerError(w http.ResponseWriter, err error) {
-	log.Printf("Internal server error during request handling: %v", err)
+	slog.Error("Internal server error during request handling", "error", err)
 	APIError(w, http.StatusInternalServerError, "Internal server error", nil)
 }
 
 // Respond with an HTTP error and log the error
 func BadRequestError(w http.ResponseWriter, message string, err error) {
-	log.Printf("Bad request (%s) during request handling: %v", message, err)
+	slog.Warn("Bad request during request handling", "reason", message, "error", err)
 	APIError(w, http.StatusBadRequest, message, err)
 }
 
@@ -0,0 +1,457 @@
+package web
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/utils"
+)
+
+// chanServUserID is the service user created by the initial migration. Admin
+// actions that need an actor are attributed to it.
+const chanServUserID = 1
+
+type AdminRenameChannelRequest struct {
+	Name string `json:"name"`
+}
+
+type AdminChannelModesRequest struct {
+	IsSecret  bool `json:"is_secret"`
+	IsPrivate bool `json:"is_private"`
+}
+
+type AdminSetServRequest struct {
+	IsServ bool `json:"is_serv"`
+}
+
+type AdminAnnounceRequest struct {
+	ChannelID *int   `json:"channel_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+type AdminSessionsResponse struct {
+	Sessions []chat.SessionSnapshot `json:"sessions"`
+}
+
+type AdminChannelsResponse struct {
+	Channels []models.ChannelInfo `json:"channels"`
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenMatches compares a presented token against a configured one in
+// constant time
+func tokenMatches(presented, configured string) bool {
+	if presented == "" || configured == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(configured)) == 1
+}
+
+// requireAdminToken protects the admin API with the configured bearer token.
+// Without a configured token the admin API is disabled.
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			utils.APIError(w, http.StatusForbidden, "Admin API is not configured", nil)
+			return
+		}
+		if !tokenMatches(bearerToken(r), s.cfg.AdminToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			utils.APIError(w, http.StatusUnauthorized, "Invalid or missing admin token", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) adminRouter(r chi.Router) {
+	r.Use(s.requireAdminToken)
+
+	r.Get("/sessions", s.handleAdminListSessions)
+	r.Delete("/sessions/{sessionID}", s.handleAdminDisconnectSession)
+	r.Post("/sessions/{sessionID}/expire", s.handleAdminExpireSession)
+
+	r.Get("/channels", s.handleAdminListChannels)
+	r.Delete("/channels/{channelID}", s.handleAdminDeleteChannel)
+	r.Post("/channels/{channelID}/rename", s.handleAdminRenameChannel)
+	r.Put("/channels/{channelID}/modes", s.handleAdminSetChannelModes)
+	r.Put("/channels/{channelID}/ops/{userID}", s.handleAdminGrantOp)
+	r.Delete("/channels/{channelID}/ops/{userID}", s.handleAdminRevokeOp)
+
+	r.Put("/users/{userID}/serv", s.handleAdminSetServ)
+
+	r.Get("/bots", s.handleAdminListBots)
+	r.Post("/bots", s.handleAdminCreateBot)
+	r.Put("/bots/{userID}/restrictions", s.handleAdminSetBotRestrictions)
+	r.Post("/bots/{userID}/token", s.handleAdminRotateBotToken)
+	r.Delete("/bots/{userID}", s.handleAdminDeleteBot)
+
+	r.Post("/announcements", s.handleAdminAnnounce)
+}
+
+// urlParamInt parses a numeric URL parameter, writing a bad request error if
+// it is not a number
+func urlParamInt(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		utils.BadRequestError(w, "Invalid "+name, err)
+		return 0, false
+	}
+	return value, true
+}
+
+// adminChannel loads the channel named by the channelID URL parameter
+func (s *Server) adminChannel(w http.ResponseWriter, r *http.Request) (*models.Channel, bool) {
+	channelID, ok := urlParamInt(w, r, "channelID")
+	if !ok {
+		return nil, false
+	}
+
+	channel, err := models.GetChannelByID(s.db, channelID)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return nil, false
+	}
+	if channel == nil {
+		utils.APIError(w, http.StatusNotFound, "Channel not found", nil)
+		return nil, false
+	}
+	return channel, true
+}
+
+// adminUser loads the user named by the userID URL parameter
+func (s *Server) adminUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, ok := urlParamInt(w, r, "userID")
+	if !ok {
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(s.db, userID)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return nil, false
+	}
+	if user == nil {
+		utils.APIError(w, http.StatusNotFound, "User not found", nil)
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *Server) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := s.wsHandler.sessions.GetSessions()
+
+	snapshots := make([]chat.SessionSnapshot, 0, len(sessions))
+	for _, session := range sessions {
+		snapshots = append(snapshots, session.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID < snapshots[j].ID
+	})
+
+	utils.SendJSON(w, AdminSessionsResponse{Sessions: snapshots})
+}
+
+func (s *Server) handleAdminDisconnectSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "sessionID")
+
+	if !s.wsHandler.terminateSession(sessionID, "Disconnected by server operator") {
+		utils.APIError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	slog.Info("Admin disconnected session", "session_id", sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminExpireSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "sessionID")
+
+	if !s.wsHandler.sessions.ExpireSession(sessionID) {
+		utils.APIError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	slog.Info("Admin expired session", "session_id", sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminListChannels(w http.ResponseWriter, r *http.Request) {
+	dbChannels, err := models.GetAllChannels(s.db)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	channels := make([]models.ChannelInfo, 0, len(dbChannels))
+	for _, channel := range dbChannels {
+		channels = append(channels, models.ChannelInfo{
+			ID:        channel.ID,
+			Name:      channel.Name,
+			Topic:     channel.Topic,
+			UserCount: s.wsHandler.sessions.GetChannelUserCount(channel.ID),
+			IsSecret:  channel.IsSecret,
+			IsPrivate: channel.IsPrivate,
+		})
+	}
+
+	utils.SendJSON(w, AdminChannelsResponse{Channels: channels})
+}
+
+func (s *Server) handleAdminDeleteChannel(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.adminChannel(w, r)
+	if !ok {
+		return
+	}
+
+	// Everybody still in the channel leaves it. The leave events go out
+	// before unsubscribing so that clients drop the channel.
+	for _, session := range s.wsHandler.sessions.GetSessions() {
+		if session.UserID == nil || session.Nickname == nil || !session.IsInChannel(channel.ID) {
+			continue
+		}
+		leaveEvent := WSEvent{
+			Type:      "event",
+			ChannelID: channel.ID,
+			Event:     "left",
+			UserID:    *session.UserID,
+			Nickname:  *session.Nickname,
+			SentAt:    time.Now().UTC().Format(time.RFC3339),
+			Reason:    "channel deleted",
+		}
+		s.wsHandler.sessions.BroadcastToChannel(channel.ID, leaveEvent)
+	}
+	for _, session := range s.wsHandler.sessions.GetSessions() {
+		session.LeaveChannel(channel.ID)
+	}
+
+	if err := models.DeleteChannel(s.db, channel.ID); err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	s.pruneAttachments()
+
+	slog.Info("Admin deleted channel", "channel", channel.Name, "channel_id", channel.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminRenameChannel(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.adminChannel(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdminRenameChannelRequest
+	if !utils.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	newName, err := models.RenameChannel(s.db, channel.ID, req.Name)
+	if errors.Is(err, models.ErrChannelNameTaken) {
+		utils.APIError(w, http.StatusConflict, "Channel name is already taken", nil)
+		return
+	}
+	if err != nil {
+		utils.BadRequestError(w, "Invalid channel name", err)
+		return
+	}
+
+	renameEvent := WSEvent{
+		Type:        "event",
+		ChannelID:   channel.ID,
+		Event:       "channel_renamed",
+		UserID:      chanServUserID,
+		Nickname:    "ChanServ",
+		SentAt:      time.Now().UTC().Format(time.RFC3339),
+		ChannelName: &newName,
+	}
+	s.wsHandler.sessions.BroadcastToChannel(channel.ID, renameEvent)
+
+	slog.Info("Admin renamed channel", "channel_id", channel.ID, "old_name", channel.Name, "new_name", newName)
+	utils.SendJSON(w, models.Channel{ID: channel.ID, Name: newName, Topic: channel.Topic})
+}
+
+func (s *Server) handleAdminSetChannelModes(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.adminChannel(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdminChannelModesRequest
+	if !utils.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.SetChannelModes(s.db, channel.ID, req.IsSecret, req.IsPrivate); err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	channel.IsSecret = req.IsSecret
+	channel.IsPrivate = req.IsPrivate
+	slog.Info("Admin changed channel modes", "channel_id", channel.ID, "is_secret", req.IsSecret, "is_private", req.IsPrivate)
+	utils.SendJSON(w, channel)
+}
+
+func (s *Server) handleAdminGrantOp(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.adminChannel(w, r)
+	if !ok {
+		return
+	}
+	user, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.MakeUserOp(s.db, user.ID, channel.ID, chanServUserID); err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	s.broadcastOpChange(channel, user, "op")
+	slog.Info("Admin granted op", "channel_id", channel.ID, "user_id", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminRevokeOp(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.adminChannel(w, r)
+	if !ok {
+		return
+	}
+	user, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveUserOp(s.db, user.ID, channel.ID); err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	s.broadcastOpChange(channel, user, "deop")
+	slog.Info("Admin revoked op", "channel_id", channel.ID, "user_id", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// broadcastOpChange tells the channel that ChanServ granted (op) or revoked
+// (deop) a user's operator status
+func (s *Server) broadcastOpChange(channel *models.Channel, user *models.User, event string) {
+	s.wsHandler.sessions.BroadcastToChannel(channel.ID, WSEvent{
+		Type:      "event",
+		ChannelID: channel.ID,
+		Event:     event,
+		UserID:    user.ID,
+		Nickname:  user.Nickname,
+		SentAt:    time.Now().UTC().Format(time.RFC3339),
+
+		ActorID:       chanServUserID,
+		ActorNickname: "ChanServ",
+	})
+}
+
+func (s *Server) handleAdminSetServ(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdminSetServRequest
+	if !utils.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.SetUserServ(s.db, user.ID, req.IsServ); err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	user.IsServ = req.IsServ
+	slog.Info("Admin changed service flag", "user_id", user.ID, "is_serv", req.IsServ)
+	utils.SendJSON(w, user)
+}
+
+func (s *Server) handleAdminAnnounce(w http.ResponseWriter, r *http.Request) {
+	var req AdminAnnounceRequest
+	if !utils.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Message == "" {
+		utils.BadRequestError(w, "Announcement message is required", nil)
+		return
+	}
+
+	chanServ, err := models.GetUserByID(s.db, chanServUserID)
+	if err != nil || chanServ == nil {
+		utils.InternalServerError(w, errors.Join(errors.New("ChanServ user is missing"), err))
+		return
+	}
+
+	announceEvent := WSEvent{
+		Type:     "event",
+		Event:    "announcement",
+		UserID:   chanServ.ID,
+		Nickname: chanServ.Nickname,
+		SentAt:   time.Now().UTC().Format(time.RFC3339),
+		Message:  req.Message,
+	}
+
+	response := WSAnnounceResponse{
+		ChannelID: req.ChannelID,
+		Message:   req.Message,
+		Type:      "server",
+	}
+
+	if req.ChannelID != nil {
+		channel, err := models.GetChannelByID(s.db, *req.ChannelID)
+		if err != nil {
+			utils.InternalServerError(w, err)
+			return
+		}
+		if channel == nil {
+			utils.APIError(w, http.StatusNotFound, "Channel not found", nil)
+			return
+		}
+
+		dbMessage, err := models.CreateMessage(s.db, &channel.ID, chanServ.ID, req.Message, "announcement", chanServ.Nickname, false)
+		if err != nil {
+			utils.InternalServerError(w, err)
+			return
+		}
+
+		announceEvent.ID = dbMessage.ID
+		announceEvent.ChannelID = channel.ID
+		s.wsHandler.sessions.BroadcastToChannel(channel.ID, announceEvent)
+		response.Type = "channel"
+	} else {
+		dbMessage, err := models.CreateMessage(s.db, nil, chanServ.ID, req.Message, "announcement", chanServ.Nickname, false)
+		if err != nil {
+			utils.InternalServerError(w, err)
+			return
+		}
+
+		announceEvent.ID = dbMessage.ID
+		// ChannelID stays 0, which indicates a server-wide announcement
+		s.wsHandler.sessions.BroadcastToAll(announceEvent)
+	}
+
+	slog.Info("Admin made announcement", "type", response.Type, "channel_id", req.ChannelID)
+	utils.SendJSON(w, response)
+}
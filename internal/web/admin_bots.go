@@ -0,0 +1,164 @@
+package web
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/utils"
+)
+
+// maxBotNicknameLength limits the nickname of bot accounts
+const maxBotNicknameLength = 32
+
+type AdminCreateBotRequest struct {
+	Nickname        string   `json:"nickname"`
+	AllowedChannels []string `json:"allowed_channels"`
+	AllowedCommands []string `json:"allowed_commands"`
+}
+
+type AdminBotRestrictionsRequest struct {
+	AllowedChannels []string `json:"allowed_channels"`
+	AllowedCommands []string `json:"allowed_commands"`
+}
+
+type AdminBotsResponse struct {
+	Bots []*models.Bot `json:"bots"`
+}
+
+// AdminBotTokenResponse is returned whenever a bot token is issued. This is
+// the only time the token is visible.
+type AdminBotTokenResponse struct {
+	Bot   *models.Bot `json:"bot"`
+	Token string      `json:"token"`
+}
+
+// adminBot loads the bot named by the userID URL parameter
+func (s *Server) adminBot(w http.ResponseWriter, r *http.Request) (*models.Bot, bool) {
+	userID, ok := urlParamInt(w, r, "userID")
+	if !ok {
+		return nil, false
+	}
+
+	bot, err := models.GetBotByUserID(s.db, userID)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return nil, false
+	}
+	if bot == nil {
+		utils.APIError(w, http.StatusNotFound, "Bot not found", nil)
+		return nil, false
+	}
+	return bot, true
+}
+
+// disconnectBot removes all sessions of a bot
+func (s *Server) disconnectBot(bot *models.Bot, reason string) {
+	for _, session := range s.wsHandler.sessions.GetSessionsByUserID(bot.UserID) {
+		s.wsHandler.terminateSession(session.ID, reason)
+	}
+}
+
+func (s *Server) handleAdminListBots(w http.ResponseWriter, r *http.Request) {
+	bots, err := models.GetBots(s.db)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	utils.SendJSON(w, AdminBotsResponse{Bots: bots})
+}
+
+func (s *Server) handleAdminCreateBot(w http.ResponseWriter, r *http.Request) {
+	var req AdminCreateBotRequest
+	if !utils.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	nickname := strings.TrimSpace(req.Nickname)
+	if nickname == "" || len(nickname) > maxBotNicknameLength || strings.ContainsAny(nickname, " \t\r\n") {
+		utils.BadRequestError(w, "Invalid bot nickname", nil)
+		return
+	}
+
+	bot, token, err := models.CreateBot(s.db, nickname, req.AllowedChannels, req.AllowedCommands)
+	if errors.Is(err, models.ErrNicknameTaken) {
+		utils.APIError(w, http.StatusConflict, "Nickname is already taken", nil)
+		return
+	} else if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	slog.Info("Admin created bot", "user_id", bot.UserID, "nickname", bot.Nickname)
+	utils.SendJSONWithStatus(w, http.StatusCreated, AdminBotTokenResponse{Bot: bot, Token: token})
+}
+
+func (s *Server) handleAdminSetBotRestrictions(w http.ResponseWriter, r *http.Request) {
+	bot, ok := s.adminBot(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdminBotRestrictionsRequest
+	if !utils.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.SetBotRestrictions(s.db, bot.UserID, req.AllowedChannels, req.AllowedCommands); err != nil {
+		utils.BadRequestError(w, "Invalid restrictions", err)
+		return
+	}
+
+	bot, err := models.GetBotByUserID(s.db, bot.UserID)
+	if err != nil || bot == nil {
+		utils.InternalServerError(w, errors.Join(errors.New("bot disappeared"), err))
+		return
+	}
+
+	// Connected sessions pick up the new restrictions right away. Channels
+	// the bot is already in are left alone.
+	s.wsHandler.refreshBotSessions(bot)
+
+	slog.Info("Admin changed bot restrictions", "user_id", bot.UserID,
+		"allowed_channels", bot.AllowedChannels, "allowed_commands", bot.AllowedCommands)
+	utils.SendJSON(w, bot)
+}
+
+func (s *Server) handleAdminRotateBotToken(w http.ResponseWriter, r *http.Request) {
+	bot, ok := s.adminBot(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := models.RotateBotToken(s.db, bot.UserID)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	// Whoever holds the old token loses access immediately
+	s.disconnectBot(bot, "Bot token rotated")
+
+	slog.Info("Admin rotated bot token", "user_id", bot.UserID)
+	utils.SendJSON(w, AdminBotTokenResponse{Bot: bot, Token: token})
+}
+
+func (s *Server) handleAdminDeleteBot(w http.ResponseWriter, r *http.Request) {
+	bot, ok := s.adminBot(w, r)
+	if !ok {
+		return
+	}
+
+	s.disconnectBot(bot, "Bot deleted")
+
+	if err := models.DeleteBot(s.db, bot.UserID); err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	slog.Info("Admin deleted bot", "user_id", bot.UserID, "nickname", bot.Nickname)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,323 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"throwback-chat/internal/export"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/utils"
+)
+
+// apiMaxLimit caps the page size of the messages endpoint
+const apiMaxLimit = 200
+
+type apiAccessKey struct{}
+
+// apiAccess records what the presented token may see. The admin token is
+// privileged and can read secret and private channels.
+type apiAccess struct {
+	privileged bool
+}
+
+type APIChannelsResponse struct {
+	Channels []models.ChannelInfo `json:"channels"`
+}
+
+type APIChannelUsersResponse struct {
+	Users []models.ChannelUser `json:"users"`
+}
+
+// APIMessagesResponse is a page of channel history in chronological order.
+// NextCursor continues in the same direction: pass it as "before" for a
+// backwards page and as "after" for a forwards page.
+type APIMessagesResponse struct {
+	Messages   []*models.Message `json:"messages"`
+	HasMore    bool              `json:"has_more"`
+	NextCursor *int              `json:"next_cursor"`
+}
+
+// requireAPIToken accepts any configured API token or the admin token
+func (s *Server) requireAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.cfg.APITokens) == 0 && s.cfg.AdminToken == "" {
+			utils.APIError(w, http.StatusForbidden, "API is not configured", nil)
+			return
+		}
+
+		token := bearerToken(r)
+		var access *apiAccess
+		if tokenMatches(token, s.cfg.AdminToken) {
+			access = &apiAccess{privileged: true}
+		} else {
+			for _, configured := range s.cfg.APITokens {
+				if tokenMatches(token, configured) {
+					access = &apiAccess{}
+					break
+				}
+			}
+		}
+
+		if access == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			utils.APIError(w, http.StatusUnauthorized, "Invalid or missing API token", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiAccessKey{}, access)))
+	})
+}
+
+func requestAPIAccess(r *http.Request) *apiAccess {
+	if access, ok := r.Context().Value(apiAccessKey{}).(*apiAccess); ok {
+		return access
+	}
+	return &apiAccess{}
+}
+
+func (s *Server) apiRouter(r chi.Router) {
+	r.Use(s.requireAPIToken)
+
+	r.Get("/", s.handleAPIListChannels)
+	r.Get("/{name}", s.handleAPIGetChannel)
+	r.Get("/{name}/users", s.handleAPIChannelUsers)
+	r.Get("/{name}/messages", s.handleAPIChannelMessages)
+	r.Get("/{name}/export", s.handleAPIChannelExport)
+}
+
+// apiChannel resolves the channel named in the URL. Secret channels are
+// reported as missing unless the token is privileged.
+func (s *Server) apiChannel(w http.ResponseWriter, r *http.Request) (*models.Channel, bool) {
+	// Channel names start with '#', which has to be escaped in URLs
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil {
+		utils.BadRequestError(w, "Invalid channel name", err)
+		return nil, false
+	}
+
+	channel, err := models.GetChannelByName(s.db, name)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return nil, false
+	}
+	if channel == nil || (channel.IsSecret && !requestAPIAccess(r).privileged) {
+		utils.APIError(w, http.StatusNotFound, "Channel not found", nil)
+		return nil, false
+	}
+	return channel, true
+}
+
+// apiChannelContent resolves a channel whose members or history are about to
+// be exposed, refusing private channels for unprivileged tokens
+func (s *Server) apiChannelContent(w http.ResponseWriter, r *http.Request) (*models.Channel, bool) {
+	channel, ok := s.apiChannel(w, r)
+	if !ok {
+		return nil, false
+	}
+	if channel.IsPrivate && !requestAPIAccess(r).privileged {
+		utils.APIError(w, http.StatusForbidden, "Channel is private", nil)
+		return nil, false
+	}
+	return channel, true
+}
+
+func (s *Server) handleAPIListChannels(w http.ResponseWriter, r *http.Request) {
+	allChannels, err := models.GetAllChannelsWithInfo(s.db)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	privileged := requestAPIAccess(r).privileged
+	channels := make([]models.ChannelInfo, 0, len(allChannels))
+	for _, channel := range allChannels {
+		if channel.IsSecret && !privileged {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+
+	utils.SendJSON(w, APIChannelsResponse{Channels: channels})
+}
+
+func (s *Server) handleAPIGetChannel(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.apiChannel(w, r)
+	if !ok {
+		return
+	}
+
+	userCount, err := models.GetChannelUserCount(s.db, channel.ID)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	utils.SendJSON(w, models.ChannelInfo{
+		ID:        channel.ID,
+		Name:      channel.Name,
+		Topic:     channel.Topic,
+		UserCount: userCount,
+		IsSecret:  channel.IsSecret,
+		IsPrivate: channel.IsPrivate,
+	})
+}
+
+func (s *Server) handleAPIChannelUsers(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.apiChannelContent(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := models.GetChannelUsers(s.db, channel.ID)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	if users == nil {
+		users = []models.ChannelUser{}
+	}
+
+	utils.SendJSON(w, APIChannelUsersResponse{Users: users})
+}
+
+// queryInt parses an optional integer query parameter
+func queryInt(r *http.Request, name string) (*int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (s *Server) handleAPIChannelMessages(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.apiChannelContent(w, r)
+	if !ok {
+		return
+	}
+
+	before, err := queryInt(r, "before")
+	if err != nil {
+		utils.BadRequestError(w, "Invalid before cursor", err)
+		return
+	}
+	after, err := queryInt(r, "after")
+	if err != nil {
+		utils.BadRequestError(w, "Invalid after cursor", err)
+		return
+	}
+	if before != nil && after != nil {
+		utils.BadRequestError(w, "Only one of before and after may be given", nil)
+		return
+	}
+
+	limit := 50
+	if requested, err := queryInt(r, "limit"); err != nil {
+		utils.BadRequestError(w, "Invalid limit", err)
+		return
+	} else if requested != nil {
+		limit = max(1, min(*requested, apiMaxLimit))
+	}
+
+	// Fetch one extra message to find out whether there is another page
+	messages, err := models.GetMessageHistory(s.db, channel.ID, models.MessageHistoryOptions{
+		Limit:  limit + 1,
+		Before: before,
+		After:  after,
+	})
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	// GetMessageHistory returns cursor pages newest first, the API always
+	// answers oldest first
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].SentAt.Equal(messages[j].SentAt) {
+			return messages[i].SentAt.Before(messages[j].SentAt)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+
+	response := APIMessagesResponse{Messages: messages}
+	if len(messages) > limit {
+		response.HasMore = true
+		if after != nil {
+			// Drop the newest extra message and continue after the last one
+			response.Messages = messages[:limit]
+			response.NextCursor = &response.Messages[limit-1].ID
+		} else {
+			// Drop the oldest extra message and continue before the first one
+			response.Messages = messages[1:]
+			response.NextCursor = &response.Messages[0].ID
+		}
+	}
+	if response.Messages == nil {
+		response.Messages = []*models.Message{}
+	}
+
+	utils.SendJSON(w, response)
+}
+
+// exportOptions reads the export parameters from the query string
+func exportOptions(r *http.Request, channel *models.Channel) (export.Options, error) {
+	query := r.URL.Query()
+	opts := export.Options{Channel: channel, Location: time.UTC}
+
+	var err error
+	if opts.Format, err = export.ParseFormat(query.Get("format")); err != nil {
+		return opts, err
+	}
+	if tz := query.Get("tz"); tz != "" {
+		if opts.Location, err = time.LoadLocation(tz); err != nil {
+			return opts, fmt.Errorf("unknown time zone %q", tz)
+		}
+	}
+	if opts.From, err = export.ParseTime(query.Get("from"), opts.Location, false); err != nil {
+		return opts, err
+	}
+	if opts.To, err = export.ParseTime(query.Get("to"), opts.Location, true); err != nil {
+		return opts, err
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.From.Before(opts.To) {
+		return opts, errors.New("from must be before to")
+	}
+	return opts, nil
+}
+
+func (s *Server) handleAPIChannelExport(w http.ResponseWriter, r *http.Request) {
+	channel, ok := s.apiChannelContent(w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := exportOptions(r, channel)
+	if err != nil {
+		utils.BadRequestError(w, err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": opts.Filename()}))
+
+	// The export is streamed, so once it has started errors can only be logged
+	if err := export.Write(w, s.db, opts); err != nil {
+		slog.Error("Channel export failed", "channel", channel.Name, "channel_id", channel.ID, "format", opts.Format, "error", err)
+		return
+	}
+
+	slog.Info("Exported channel", "channel", channel.Name, "channel_id", channel.ID, "format", opts.Format,
+		"from", opts.From, "to", opts.To)
+}
@@ -0,0 +1,277 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"throwback-chat/internal/attachments"
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/utils"
+)
+
+// Uploads are multipart posts with the file in the "file" field, made with
+// the session_id of a logged in chat session like POST /api/command. Files
+// are downloaded from the URL in the response, which is what messages carry.
+
+const (
+	// attachmentURLPrefix is where attachments are downloaded from
+	attachmentURLPrefix = "/api/attachments/"
+
+	// maxAttachmentFilename bounds stored filenames, in bytes
+	maxAttachmentFilename = 255
+
+	// multipartOverhead is allowed on top of the file size for the parts'
+	// boundaries and headers
+	multipartOverhead = 64 << 10
+)
+
+// inlineContentTypes are shown by browsers instead of downloaded. SVG is
+// left out on purpose, it can carry scripts.
+var inlineContentTypes = []string{"image/gif", "image/jpeg", "image/png", "image/webp"}
+
+// WSAttachment is an attachment as messages carry it
+type WSAttachment struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+func attachmentPayload(attachment *models.Attachment) WSAttachment {
+	return WSAttachment{
+		ID:          attachment.ID,
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		URL:         attachmentURLPrefix + attachment.Token,
+	}
+}
+
+func attachmentPayloads(list []*models.Attachment) []WSAttachment {
+	if len(list) == 0 {
+		return nil
+	}
+	payloads := make([]WSAttachment, 0, len(list))
+	for _, attachment := range list {
+		payloads = append(payloads, attachmentPayload(attachment))
+	}
+	return payloads
+}
+
+// cleanFilename keeps the last path element of an uploaded filename without
+// control characters, shortened to fit
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(strings.ToValidUTF8(name, ""))
+
+	for len(name) > maxAttachmentFilename {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Attachments == nil {
+		utils.APIError(w, http.StatusNotFound, "Uploads are disabled", nil)
+		return
+	}
+
+	session := s.wsHandler.sessions.GetSession(r.URL.Query().Get("session_id"))
+	if session == nil {
+		utils.APIError(w, http.StatusUnauthorized, "Session not found", nil)
+		return
+	}
+	snapshot := session.Snapshot()
+	if snapshot.UserID == nil {
+		utils.APIError(w, http.StatusUnauthorized, "Must be logged in to upload files", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.AttachmentMaxSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.BadRequestError(w, "Expected a multipart form", err)
+		return
+	}
+
+	// Skip to the file, other fields are ignored
+	var part io.ReadCloser
+	var filename string
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			utils.BadRequestError(w, "Missing file field", err)
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename = p, p.FileName()
+			break
+		}
+	}
+	defer part.Close()
+
+	// The type is taken from the content, what the client claims is ignored
+	buffered := bufio.NewReaderSize(part, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		utils.BadRequestError(w, "Failed to read file", err)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !slices.Contains(s.cfg.AttachmentTypes, contentType) {
+		utils.APIError(w, http.StatusUnsupportedMediaType, "File type not allowed: "+contentType, nil)
+		return
+	}
+
+	hash, size, err := s.cfg.Attachments.Put(buffered, s.cfg.AttachmentMaxSize)
+	if errors.Is(err, attachments.ErrTooLarge) {
+		utils.APIError(w, http.StatusRequestEntityTooLarge, "File is too large", nil)
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.APIError(w, http.StatusRequestEntityTooLarge, "File is too large", nil)
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	attachment, err := models.CreateAttachment(s.db, *snapshot.UserID, cleanFilename(filename), contentType, hash, size)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	session.Logger().Info("File uploaded",
+		"attachment_id", attachment.ID, "content_type", contentType, "size", size, "sha256", hash)
+
+	utils.SendJSONWithStatus(w, http.StatusCreated, attachmentPayload(attachment))
+}
+
+func (s *Server) handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Attachments == nil {
+		utils.APIError(w, http.StatusNotFound, "Uploads are disabled", nil)
+		return
+	}
+
+	attachment, err := models.GetAttachmentByToken(s.db, chi.URLParam(r, "token"))
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	if attachment == nil {
+		utils.APIError(w, http.StatusNotFound, "Attachment not found", nil)
+		return
+	}
+
+	file, err := s.cfg.Attachments.Open(attachment.SHA256)
+	if errors.Is(err, fs.ErrNotExist) {
+		utils.APIError(w, http.StatusNotFound, "Attachment not found", nil)
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	defer file.Close()
+
+	disposition := "attachment"
+	if slices.Contains(inlineContentTypes, attachment.ContentType) {
+		disposition = "inline"
+	}
+
+	// Filenames that can't be encoded are left to the browser to pick
+	if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}); formatted != "" {
+		disposition = formatted
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", attachment.ContentType)
+	header.Set("Content-Disposition", disposition)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("Cache-Control", "private, max-age=86400")
+
+	http.ServeContent(w, r, "", attachment.CreatedAt, file)
+}
+
+// pruneAttachments removes the files no attachment refers to anymore
+func (s *Server) pruneAttachments() {
+	if s.cfg.Attachments == nil {
+		return
+	}
+
+	hashes, err := models.GetAttachmentHashes(s.db)
+	if err != nil {
+		slog.Error("Failed to load attachment hashes", "error", err)
+		return
+	}
+
+	removed, err := s.cfg.Attachments.Prune(func(hash string) bool { return hashes[hash] })
+	if err != nil {
+		slog.Error("Failed to prune attachment files", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("Pruned attachment files", "removed", removed)
+	}
+}
+
+// attachToMessage sends attachments with a stored message and returns them
+// as the message carries them. Attachments that were sent by a concurrent
+// message are left out.
+func (h *WebSocketHandler) attachToMessage(sess *chat.Session, ids []int, message *models.Message) []WSAttachment {
+	attached, err := models.AttachToMessage(h.db, *sess.UserID, ids, message.ID, *message.ChannelID)
+	if err != nil {
+		sess.Logger().Error("Failed to attach files", "message_id", message.ID, "error", err)
+		return nil
+	}
+	if attached < len(ids) {
+		sess.Logger().Warn("Attachments were sent already", "message_id", message.ID, "requested", len(ids), "attached", attached)
+	}
+
+	list, err := models.GetMessageAttachments(h.db, []int{message.ID})
+	if err != nil {
+		sess.Logger().Error("Failed to load attachments", "message_id", message.ID, "error", err)
+		return nil
+	}
+	return attachmentPayloads(list[message.ID])
+}
+
+// uniqueIDs drops repeated IDs, keeping the first occurrence
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
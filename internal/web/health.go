@@ -14,7 +14,7 @@ type HealthResponse struct {
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status: "ok",
-		DBPath: s.dbPath,
+		DBPath: s.cfg.DBPath,
 	}
 	utils.SendJSON(w, response)
 }
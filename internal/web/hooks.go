@@ -0,0 +1,241 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"throwback-chat/internal/logging"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/utils"
+)
+
+// maxWebhookBodySize caps the size of a webhook request body
+const maxWebhookBodySize = 64 << 10
+
+// WebhookPayload is the body accepted by incoming webhooks. Text is the
+// field Slack style integrations send and is used when Message is empty.
+type WebhookPayload struct {
+	Message   string `json:"message"`
+	Text      string `json:"text"`
+	Announce  bool   `json:"announce"`
+	IsPassive bool   `json:"is_passive"`
+}
+
+type WebhookResponse struct {
+	OK        bool `json:"ok"`
+	MessageID int  `json:"message_id"`
+}
+
+// hookLimiter is a token bucket per webhook. Each bucket holds up to one
+// minute worth of posts and refills continuously.
+type hookLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	buckets   map[int]*hookBucket
+}
+
+type hookBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newHookLimiter(perMinute int) *hookLimiter {
+	return &hookLimiter{
+		perMinute: perMinute,
+		buckets:   make(map[int]*hookBucket),
+	}
+}
+
+// Allow takes a token from the webhook's bucket. If the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *hookLimiter) Allow(webhookID int) (bool, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(l.perMinute)
+	perSecond := capacity / 60
+
+	bucket, ok := l.buckets[webhookID]
+	if !ok {
+		bucket = &hookBucket{tokens: capacity, last: now}
+		l.buckets[webhookID] = bucket
+	}
+
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*perSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// decodeWebhookPayload accepts JSON bodies, Slack style form posts with a
+// JSON "payload" field, and plain text bodies
+func decodeWebhookPayload(r *http.Request) (*WebhookPayload, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	// curl and friends default to a form content type even for JSON bodies
+	trimmed := bytes.TrimSpace(body)
+	if mediaType == "application/x-www-form-urlencoded" && bytes.HasPrefix(trimmed, []byte("{")) {
+		mediaType = "application/json"
+	}
+
+	var payload WebhookPayload
+	switch mediaType {
+	case "text/plain":
+		payload.Message = string(body)
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		if raw := form.Get("payload"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+				return nil, err
+			}
+		} else {
+			payload.Message = form.Get("message")
+			payload.Announce, _ = strconv.ParseBool(form.Get("announce"))
+		}
+	default:
+		// Anything else, including a missing content type, is treated as JSON
+		if err := json.Unmarshal(trimmed, &payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if payload.Message == "" {
+		payload.Message = payload.Text
+	}
+	payload.Message = strings.TrimSpace(payload.Message)
+	return &payload, nil
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := models.GetWebhookByToken(s.db, chi.URLParam(r, "token"))
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	if webhook == nil {
+		utils.APIError(w, http.StatusNotFound, "Webhook not found", nil)
+		return
+	}
+
+	if ok, wait := s.hookLimiter.Allow(webhook.ID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.APIError(w, http.StatusTooManyRequests, "Rate limit exceeded", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBodySize)
+	payload, err := decodeWebhookPayload(r)
+	if err != nil {
+		utils.BadRequestError(w, "Invalid webhook payload", err)
+		return
+	}
+	if payload.Message == "" {
+		utils.BadRequestError(w, "Message is required", nil)
+		return
+	}
+
+	nickname := webhook.Nickname
+	if nickname == "" {
+		nickname = s.cfg.WebhookNickname
+	}
+
+	dbMessage, err := s.postWebhookMessage(webhook.ChannelID, nickname, payload.Message, payload.Announce, payload.IsPassive)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	slog.Debug("Webhook posted", "webhook_id", webhook.ID, "channel_id", webhook.ChannelID,
+		"event", dbMessage.Event, logging.Content(payload.Message))
+
+	utils.SendJSON(w, WebhookResponse{OK: true, MessageID: dbMessage.ID})
+}
+
+// postWebhookMessage stores and broadcasts a message or announcement posted
+// by a webhook. Webhooks have no user of their own and post as ChanServ under
+// their nickname. Their posts do not trigger outgoing webhooks, which keeps
+// webhooks from feeding each other in a loop.
+func (s *Server) postWebhookMessage(channelID int, nickname, text string, announce, isPassive bool) (*models.Message, error) {
+	event := "message"
+	if announce {
+		event = "announcement"
+		isPassive = false
+	}
+
+	dbMessage, err := models.CreateMessage(s.db, &channelID, chanServUserID, text, event, nickname, isPassive)
+	if err != nil {
+		return nil, err
+	}
+
+	sentAt := dbMessage.SentAt.Format(time.RFC3339)
+	if announce {
+		s.wsHandler.sessions.BroadcastToChannel(channelID, WSEvent{
+			Type:      "event",
+			ID:        dbMessage.ID,
+			ChannelID: channelID,
+			Event:     "announcement",
+			UserID:    chanServUserID,
+			Nickname:  nickname,
+			SentAt:    sentAt,
+			Message:   text,
+		})
+	} else {
+		s.wsHandler.unfurler.Unfurl(dbMessage)
+		s.wsHandler.sessions.BroadcastToChannel(channelID, WSMessage{
+			Type:      "message",
+			ID:        dbMessage.ID,
+			ChannelID: channelID,
+			Message:   text,
+			IsPassive: isPassive,
+			SentAt:    sentAt,
+			UserID:    chanServUserID,
+			Nickname:  nickname,
+			HTML:      dbMessage.HTML,
+			Plain:     dbMessage.Plain,
+		})
+	}
+
+	return dbMessage, nil
+}
+
+// postHookResponse posts the reply of an outgoing webhook into its channel
+func (s *Server) postHookResponse(hook *models.OutgoingWebhook, text string) {
+	nickname := hook.Nickname
+	if nickname == "" {
+		nickname = s.cfg.WebhookNickname
+	}
+
+	if _, err := s.postWebhookMessage(hook.ChannelID, nickname, text, false, false); err != nil {
+		slog.Error("Failed to post outgoing webhook response", "webhook_id", hook.ID, "channel_id", hook.ChannelID, "error", err)
+	}
+}
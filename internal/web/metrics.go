@@ -0,0 +1,65 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/db"
+	"throwback-chat/internal/metrics"
+	"throwback-chat/internal/models"
+)
+
+// statsCollector reports gauges that are computed from live state at scrape
+// time rather than tracked incrementally
+type statsCollector struct {
+	db       *db.DB
+	sessions *chat.SessionManager
+
+	connected *prometheus.Desc
+	loggedIn  *prometheus.Desc
+	resumable *prometheus.Desc
+	channels  *prometheus.Desc
+}
+
+func newStatsCollector(database *db.DB, sessions *chat.SessionManager) *statsCollector {
+	return &statsCollector{
+		db:       database,
+		sessions: sessions,
+		connected: prometheus.NewDesc("tbchat_sessions_connected",
+			"Sessions with an open connection.", nil, nil),
+		loggedIn: prometheus.NewDesc("tbchat_users_logged_in",
+			"Connected sessions with a logged in user.", nil, nil),
+		resumable: prometheus.NewDesc("tbchat_sessions_resumable",
+			"Logged in sessions that are disconnected but can still be resumed.", nil, nil),
+		channels: prometheus.NewDesc("tbchat_channels",
+			"Channels currently existing.", nil, nil),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connected
+	ch <- c.loggedIn
+	ch <- c.resumable
+	ch <- c.channels
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.sessions.Stats()
+	ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, float64(stats.Connected))
+	ch <- prometheus.MustNewConstMetric(c.loggedIn, prometheus.GaugeValue, float64(stats.LoggedIn))
+	ch <- prometheus.MustNewConstMetric(c.resumable, prometheus.GaugeValue, float64(stats.Resumable))
+
+	channels, err := models.CountChannels(c.db)
+	if err != nil {
+		slog.Error("Failed to count channels for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.channels, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.channels, prometheus.GaugeValue, float64(channels))
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics.Handler().ServeHTTP(w, r)
+}
@@ -1,38 +1,100 @@
 package web
 
 import (
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/netip"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"throwback-chat/internal/attachments"
 	"throwback-chat/internal/db"
+	"throwback-chat/internal/hooks"
+	"throwback-chat/internal/metrics"
+	"throwback-chat/internal/unfurl"
 )
 
+// Config holds the server settings that are not stored in the database
+type Config struct {
+	DBPath     string
+	AdminToken string   // bearer token for /api/admin; the admin API is disabled if empty
+	APITokens  []string // bearer tokens for the read-only REST API
+
+	WebhookNickname  string // nickname webhooks post under unless they set their own
+	WebhookRateLimit int    // posts per minute and webhook; unlimited if zero
+
+	// Internal networks outgoing webhooks may reach, on top of the public
+	// internet
+	WebhookAllowedNets []netip.Prefix
+
+	WebFS fs.FS // built web client to serve at /; not served if nil
+
+	ServerName string // name reported to clients by hello
+
+	Attachments       *attachments.Store // where uploads are stored; uploads are disabled if nil
+	AttachmentMaxSize int64              // largest upload in bytes
+	AttachmentTypes   []string           // content types that may be uploaded
+
+	LinkPreviews bool // fetch links in messages to preview them
+}
+
 type Server struct {
-	db        *db.DB
-	dbPath    string
-	wsHandler *WebSocketHandler
+	db          *db.DB
+	cfg         Config
+	wsHandler   *WebSocketHandler
+	hookLimiter *hookLimiter
 }
 
-func NewServer(database *db.DB, dbPath string) *Server {
-	return &Server{
-		db:        database,
-		dbPath:    dbPath,
-		wsHandler: NewWebSocketHandler(database),
+func NewServer(database *db.DB, cfg Config) *Server {
+	s := &Server{
+		db:          database,
+		cfg:         cfg,
+		wsHandler:   NewWebSocketHandler(database),
+		hookLimiter: newHookLimiter(cfg.WebhookRateLimit),
+	}
+	s.wsHandler.hooks = hooks.NewDispatcher(database, s.postHookResponse, cfg.WebhookAllowedNets)
+	s.wsHandler.webhookAllowedNets = cfg.WebhookAllowedNets
+	s.wsHandler.serverName = cfg.ServerName
+	if cfg.LinkPreviews {
+		s.wsHandler.unfurler = unfurl.NewUnfurler(database, s.wsHandler.broadcastUnfurl)
 	}
+	if cfg.Attachments != nil {
+		s.wsHandler.attachmentMaxSize = cfg.AttachmentMaxSize
+	}
+
+	if err := metrics.Registry.Register(newStatsCollector(database, s.wsHandler.sessions)); err != nil {
+		slog.Error("Failed to register stats collector", "error", err)
+	}
+
+	return s
 }
 
 func (s *Server) SetupRouter() http.Handler {
 	r := chi.NewRouter()
 
 	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
 	r.Use(middleware.RealIP)
+	r.Use(middleware.RequestID)
+	r.Use(requestLogger)
+	r.Use(middleware.Recoverer)
 
 	// Routes
 	r.Get("/api/health", s.handleHealth)
+	r.Get("/api/metrics", s.handleMetrics)
 	r.Get("/ws", s.handleWebSocket)
+	r.Get("/api/stream", s.handleStream)
+	r.Post("/api/command", s.handleCommand)
+	r.Route("/api/admin", s.adminRouter)
+	r.Route("/api/channels", s.apiRouter)
+	r.Post("/api/hooks/{token}", s.handleWebhook)
+	r.Post("/api/attachments", s.handleUploadAttachment)
+	r.Get("/api/attachments/{token}", s.handleDownloadAttachment)
+
+	// The web client takes every path no route above claims
+	if s.cfg.WebFS != nil {
+		r.NotFound(newStaticHandler(s.cfg.WebFS).ServeHTTP)
+	}
 
 	return r
 }
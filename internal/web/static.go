@@ -0,0 +1,166 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"throwback-chat/internal/utils"
+)
+
+// Vite puts hashed, never changing files under /assets
+const (
+	assetsPrefix         = "/assets/"
+	immutableCacheHeader = "public, max-age=31536000, immutable"
+)
+
+// staticTypes covers extensions the mime package may not know about on
+// every platform
+var staticTypes = map[string]string{
+	".js":          "text/javascript; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".svg":         "image/svg+xml",
+	".ico":         "image/x-icon",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".txt":         "text/plain; charset=utf-8",
+	".webmanifest": "application/manifest+json",
+}
+
+// precompressed lists the encodings the build may have stored next to a
+// file, in order of preference
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandler serves the web client. Paths that aren't files get
+// index.html, so client side routes survive a reload.
+type staticHandler struct {
+	fsys fs.FS
+}
+
+func newStaticHandler(fsys fs.FS) *staticHandler {
+	return &staticHandler{fsys: fsys}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Unknown API routes are errors, not pages
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api" {
+		utils.APIError(w, http.StatusNotFound, "Not found", nil)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		utils.APIError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	if !h.isFile(name) {
+		// Missing assets are real 404s, anything else is a client route
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+
+	if strings.HasPrefix("/"+name, assetsPrefix) {
+		w.Header().Set("Cache-Control", immutableCacheHeader)
+	} else {
+		// index.html names the current assets and has to be revalidated
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	h.serveFile(w, r, name)
+}
+
+func (h *staticHandler) isFile(name string) bool {
+	info, err := fs.Stat(h.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// serveFile writes a file, preferring a precompressed variant the client
+// accepts
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	contentType, ok := staticTypes[path.Ext(name)]
+	if !ok {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	served := name
+	for _, variant := range precompressed {
+		if acceptsEncoding(r, variant.encoding) && h.isFile(name+variant.extension) {
+			w.Header().Set("Content-Encoding", variant.encoding)
+			served = name + variant.extension
+			break
+		}
+	}
+
+	file, err := h.fsys.Open(served)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			utils.InternalServerError(w, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	// Embedded files have no modification time, ServeContent then leaves out
+	// Last-Modified
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header allows an
+// encoding. A q value of 0 refuses it.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(token), encoding) {
+				continue
+			}
+			q := 1.0
+			if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+				q, _ = strconv.ParseFloat(value, 64)
+			}
+			return q > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/utils"
+)
+
+// The SSE transport is a fallback for clients behind proxies that break
+// WebSockets. GET /api/stream carries everything the server would write to
+// the WebSocket, and POST /api/command takes the commands a client would send
+// over it. Both are bound to the same chat.Session, so a client can move
+// between transports by reconnecting with its session_id.
+
+const (
+	sseQueueSize       = 256
+	ssePingInterval    = 15 * time.Second
+	maxCommandBodySize = 64 << 10
+)
+
+var (
+	errStreamClosed   = errors.New("stream is closed")
+	errStreamOverflow = errors.New("stream is not keeping up")
+)
+
+// StreamSessionEvent is the first message on every stream. It tells the
+// client which session_id to post commands with.
+type StreamSessionEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+}
+
+// sseConn is the chat.Conn of an SSE stream. Messages are queued and written
+// by the stream handler, so writers holding the session lock never wait on
+// the network. A client that falls too far behind is disconnected.
+type sseConn struct {
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newSSEConn() *sseConn {
+	return &sseConn{
+		queue: make(chan []byte, sseQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+func (c *sseConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.done:
+		return errStreamClosed
+	default:
+	}
+
+	select {
+	case c.queue <- data:
+		return nil
+	default:
+		c.Close()
+		return errStreamOverflow
+	}
+}
+
+func (c *sseConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	s.wsHandler.HandleStream(w, r)
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	s.wsHandler.HandleCommand(w, r)
+}
+
+// HandleStream serves a session's messages as Server-Sent Events
+func (h *WebSocketHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.InternalServerError(w, errors.New("response writer does not support flushing"))
+		return
+	}
+
+	remoteIP := clientIP(r)
+	conn := newSSEConn()
+
+	// Queue the session event before the session can write anything else
+	var session *chat.Session
+	if existingSessionID := r.URL.Query().Get("session_id"); existingSessionID != "" {
+		session = h.sessions.GetSession(existingSessionID)
+	}
+	if session != nil {
+		conn.WriteJSON(StreamSessionEvent{Type: "session", SessionID: session.ID})
+		slog.Debug("Reusing existing session for stream", "session_id", session.ID, "remote_ip", remoteIP)
+		h.resumeSession(session, conn, remoteIP)
+	} else {
+		sessionID := uuid.New().String()
+		conn.WriteJSON(StreamSessionEvent{Type: "session", SessionID: sessionID})
+		session = h.sessions.AddSession(sessionID, conn, remoteIP)
+	}
+
+	defer func() {
+		h.handleUnexpectedDisconnect(session.ID, conn)
+		conn.Close()
+	}()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Keep nginx and friends from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	session.Logger().Info("Event stream established")
+
+	ping := time.NewTicker(ssePingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			session.Logger().Info("Event stream closed by client")
+			return
+		case <-conn.done:
+			session.Logger().Info("Event stream closed by server")
+			return
+		case data := <-conn.queue:
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		case <-ping.C:
+			// Comments keep proxies from timing out an idle stream
+			_, err = io.WriteString(w, ": ping\n\n")
+		}
+		if err != nil {
+			session.Logger().Info("Event stream write failed", "error", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// HandleCommand runs a single command for a session. The response is
+// delivered over the session's connection, not in the HTTP response.
+func (h *WebSocketHandler) HandleCommand(w http.ResponseWriter, r *http.Request) {
+	session := h.sessions.GetSession(r.URL.Query().Get("session_id"))
+	if session == nil {
+		utils.APIError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+	if !session.Snapshot().Connected {
+		utils.APIError(w, http.StatusConflict, "Session has no open stream", nil)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCommandBodySize))
+	if err != nil {
+		utils.BadRequestError(w, "Invalid request body", err)
+		return
+	}
+
+	h.sessions.UpdateHeartbeat(session.ID)
+
+	if err := h.handleMessage(session, data); err != nil {
+		if _, isTerminate := err.(*websocketTerminateError); isTerminate {
+			// Invalid JSON ends the connection, just like on the WebSocket
+			session.Logger().Info("Terminating stream", "reason", err)
+			session.CloseConn()
+			utils.BadRequestError(w, "Invalid command", err)
+			return
+		}
+		session.Logger().Error("Failed to handle message", "error", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"throwback-chat/internal/utils"
+)
+
+// Plain HTTP modes when the server terminates TLS itself
+const (
+	HTTPModeRedirect = "redirect"
+	HTTPModeRefuse   = "refuse"
+)
+
+// PlainHTTPHandler answers requests on the plain HTTP port of a TLS server.
+// It either redirects them to the same URL over HTTPS or refuses them.
+func PlainHTTPHandler(mode, httpsPort string) http.Handler {
+	if mode == HTTPModeRefuse {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			utils.APIError(w, http.StatusForbidden, "Plain HTTP is disabled, use HTTPS", nil)
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.Trim(host, "[]")
+
+		if httpsPort == "443" {
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+		} else {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawPath:  r.URL.RawPath,
+			RawQuery: r.URL.RawQuery,
+		}
+		// 308 keeps the method, so webhook POSTs arrive intact
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
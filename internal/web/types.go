@@ -1,11 +1,95 @@
 package web
 
+import (
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
 type WSMessage struct {
 	Type      string `json:"type"`
+	ID        int    `json:"id,omitempty"` // with message-ids only
 	ChannelID int    `json:"channel_id"`
 	Message   string `json:"message"`
 	IsPassive bool   `json:"is_passive"`
 	SentAt    string `json:"sent_at"`
 	UserID    int    `json:"user_id"`
 	Nickname  string `json:"nickname"`
+	Batch     string `json:"batch,omitempty"`  // set inside batches
+	ReqID     string `json:"req_id,omitempty"` // with echo-message, for the sender only
+
+	// Message rendered for display: sanitized HTML and plain text
+	HTML  string `json:"html,omitempty"`
+	Plain string `json:"plain,omitempty"`
+
+	// Set on thread replies
+	ReplyTo        int  `json:"reply_to,omitempty"`
+	ReplyBroadcast bool `json:"reply_broadcast,omitempty"`
+
+	// Stored alongside the message, sent in history and playback.
+	// Attachments are sent live too.
+	Attachments []WSAttachment           `json:"attachments,omitempty"`
+	Previews    []models.LinkPreview     `json:"previews,omitempty"`
+	Reactions   []models.ReactionSummary `json:"reactions,omitempty"`
+	ReplyCount  int                      `json:"reply_count,omitempty"`
+	LastReplyAt string                   `json:"last_reply_at,omitempty"`
+
+	// echoTo is the session that sent the message
+	echoTo *chat.Session
+}
+
+// ForSession drops the fields the session did not negotiate. Replies that
+// were not broadcast to the channel only go to sessions with threads.
+func (m WSMessage) ForSession(s *chat.Session) interface{} {
+	if m.ReplyTo != 0 && !m.ReplyBroadcast && !s.HasCapability(chat.CapThreads) {
+		return nil
+	}
+	if !s.HasCapability(chat.CapThreads) {
+		m.ReplyTo, m.ReplyBroadcast = 0, false
+		m.ReplyCount, m.LastReplyAt = 0, ""
+	}
+	if !s.HasCapability(chat.CapMessageIDs) {
+		m.ID = 0
+	}
+	if !s.HasCapability(chat.CapRendered) {
+		m.HTML, m.Plain = "", ""
+	}
+	if !s.HasCapability(chat.CapAttachments) {
+		m.Attachments = nil
+	}
+	if !s.HasCapability(chat.CapPreviews) {
+		m.Previews = nil
+	}
+	if !s.HasCapability(chat.CapReactions) {
+		m.Reactions = nil
+	}
+	if s != m.echoTo || !s.HasCapability(chat.CapEchoMessage) {
+		m.ReqID = ""
+	}
+	return m
+}
+
+// echoedBy marks the message as sent by a request of sess, so that its copy
+// of the broadcast can be matched with the request
+func (m WSMessage) echoedBy(sess *chat.Session, reqID string) WSMessage {
+	m.echoTo = sess
+	m.ReqID = reqID
+	return m
+}
+
+// WSBatch opens or closes a batch of messages for clients with batch. The
+// messages in between carry the batch ID.
+type WSBatch struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	State     string `json:"state"`                // start or end
+	BatchType string `json:"batch_type,omitempty"` // what the batch holds, on start only
+	ChannelID int    `json:"channel_id,omitempty"`
+}
+
+// messageID returns the ID of a stored message, or zero if storing it failed
+func messageID(msg *models.Message) int {
+	if msg == nil {
+		return 0
+	}
+	return msg.ID
 }
@@ -1,14 +1,21 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"throwback-chat/internal/chat"
 	"throwback-chat/internal/db"
+	"throwback-chat/internal/hooks"
+	"throwback-chat/internal/metrics"
 	"throwback-chat/internal/models"
+	"throwback-chat/internal/unfurl"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -27,15 +34,48 @@ type WSRequest struct {
 	ReqID string `json:"req_id,omitempty"`
 }
 
+// Logger returns the session logger annotated with the request's command
+func (r WSRequest) Logger(sess *chat.Session) *slog.Logger {
+	return sess.Logger().With("req_id", r.ReqID, "command", r.Cmd)
+}
+
 // WSEvent represents a WebSocket event message
 type WSEvent struct {
 	Type      string  `json:"type"`
+	ID        int     `json:"id,omitempty"` // with message-ids, for stored events only
 	ChannelID int     `json:"channel_id"`
 	Event     string  `json:"event"`
 	UserID    int     `json:"user_id"`
 	Nickname  string  `json:"nickname"`
 	SentAt    string  `json:"sent_at"`
 	Topic     *string `json:"topic,omitempty"`
+	// Set on channel_renamed events
+	ChannelName *string `json:"channel_name,omitempty"`
+	Batch       string  `json:"batch,omitempty"` // set inside batches
+
+	// Text of announcements
+	Message string `json:"message,omitempty"`
+	// Reason given for left and kicked events
+	Reason string `json:"reason,omitempty"`
+	// Who caused the event, for kicked events the operator
+	ActorID       int    `json:"actor_id,omitempty"`
+	ActorNickname string `json:"actor_nickname,omitempty"`
+	// Set on nick_change events, Nickname is the new nickname too
+	OldNickname string `json:"old_nickname,omitempty"`
+	NewNickname string `json:"new_nickname,omitempty"`
+}
+
+// ForSession drops the fields the session did not negotiate
+func (e WSEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapMessageIDs) {
+		e.ID = 0
+	}
+	if !s.HasCapability(chat.CapEventDetail) {
+		e.Message, e.Reason = "", ""
+		e.ActorID, e.ActorNickname = 0, ""
+		e.OldNickname, e.NewNickname = "", ""
+	}
+	return e
 }
 
 // SessionInfoResponse represents the response data for session_info command
@@ -51,6 +91,7 @@ type ChannelInfo struct {
 	ID    int    `json:"id"`
 	Name  string `json:"name"`
 	Topic string `json:"topic"`
+	models.UnreadState
 }
 
 // ChannelUsersResponse represents the response data for channel_users command
@@ -80,6 +121,9 @@ func DecodeWSData(sess *chat.Session, data []byte, reqID string, target interfac
 	return nil
 }
 
+// errUnknownCommand is returned by dispatchCommand for commands it does not know
+var errUnknownCommand = errors.New("unknown command")
+
 // Custom error type to signal websocket termination
 type websocketTerminateError struct {
 	message string
@@ -92,6 +136,15 @@ func (e *websocketTerminateError) Error() string {
 type WebSocketHandler struct {
 	db       *db.DB
 	sessions *chat.SessionManager
+	hooks    *hooks.Dispatcher // fires outgoing webhooks; nil disables them
+	unfurler *unfurl.Unfurler  // previews links in messages; nil disables them
+
+	serverName string // reported to clients by hello
+	typing     *chat.TypingTracker
+
+	attachmentMaxSize int64 // largest upload, reported by hello; zero if uploads are disabled
+
+	webhookAllowedNets []netip.Prefix // internal networks outgoing webhooks may reach
 }
 
 func NewWebSocketHandler(database *db.DB) *WebSocketHandler {
@@ -100,6 +153,8 @@ func NewWebSocketHandler(database *db.DB) *WebSocketHandler {
 		sessions: chat.NewSessionManager(),
 	}
 
+	h.typing = chat.NewTypingTracker(h.broadcastTyping)
+
 	// Set up callback for expired sessions to generate leave events
 	h.sessions.SetSessionExpiredCallback(h.handleExpiredSession)
 
@@ -110,51 +165,69 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	s.wsHandler.HandleConnection(w, r)
 }
 
+// clientIP returns the client address without the port. RealIP has already
+// replaced RemoteAddr with the forwarded address where applicable.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 func (h *WebSocketHandler) HandleConnection(w http.ResponseWriter, r *http.Request) {
+	// Bots authenticate before the upgrade so that a bad token gets a
+	// proper HTTP error
+	bot, ok := h.authenticateBot(w, r)
+	if !ok {
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		slog.Warn("Failed to upgrade connection", "remote_ip", clientIP(r), "error", err)
 		return
 	}
 
+	remoteIP := clientIP(r)
+
 	// Check for existing session ID in query parameters
 	var sessionID string
 	var session *chat.Session
 	existingSessionID := r.URL.Query().Get("session_id")
 
-	if existingSessionID != "" {
+	if bot != nil {
+		session = h.attachBotSession(bot, conn, remoteIP)
+		sessionID = session.ID
+	} else if existingSessionID != "" {
 		// Try to reuse existing session
 		if existingSession := h.sessions.GetSession(existingSessionID); existingSession != nil {
-			log.Printf("Reusing existing session: %s", existingSessionID)
+			slog.Debug("Reusing existing session", "session_id", existingSessionID, "remote_ip", remoteIP)
 			sessionID = existingSessionID
-			// Transfer the connection to the existing session
-			h.sessions.TransferConnection(existingSessionID, conn)
 			session = existingSession
-			// Generate join events for session restoration if user was logged in
-			h.generateJoinEventsForSessionRestore(session)
+			h.resumeSession(session, conn, remoteIP)
 		} else {
-			log.Printf("Requested session %s not found, creating new session", existingSessionID)
+			slog.Debug("Requested session not found, creating new session", "session_id", existingSessionID, "remote_ip", remoteIP)
 			sessionID = uuid.New().String()
-			session = h.sessions.AddSession(sessionID, conn)
+			session = h.sessions.AddSession(sessionID, conn, remoteIP)
 		}
 	} else {
 		// Create new session
 		sessionID = uuid.New().String()
-		session = h.sessions.AddSession(sessionID, conn)
+		session = h.sessions.AddSession(sessionID, conn, remoteIP)
 	}
 
 	defer func() {
 		// Generate leave events for unexpected disconnections
-		h.handleUnexpectedDisconnect(sessionID)
+		h.handleUnexpectedDisconnect(sessionID, conn)
 		conn.Close()
 	}()
 
-	log.Printf("WebSocket connection established: %s", sessionID)
+	session.Logger().Info("WebSocket connection established")
 
 	for {
 		_, messageData, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("Failed to read message from %s: %v", sessionID, err)
+			session.Logger().Info("WebSocket connection closed", "reason", err)
 			break
 		}
 
@@ -163,10 +236,10 @@ func (h *WebSocketHandler) HandleConnection(w http.ResponseWriter, r *http.Reque
 		if err := h.handleMessage(session, messageData); err != nil {
 			// Check if this is a websocket termination error
 			if _, isTerminate := err.(*websocketTerminateError); isTerminate {
-				log.Printf("Terminating websocket connection %s: %v", sessionID, err)
+				session.Logger().Info("Terminating websocket connection", "reason", err)
 				break
 			}
-			log.Printf("Failed to handle message from %s: %v", sessionID, err)
+			session.Logger().Error("Failed to handle message", "error", err)
 		}
 	}
 }
@@ -178,9 +251,50 @@ func (h *WebSocketHandler) handleMessage(sess *chat.Session, data []byte) error
 		return &websocketTerminateError{message: "Invalid JSON in message"}
 	}
 
-	log.Printf("Received command: %s from session %s", msg.Cmd, sess.ID)
+	start := time.Now()
+	done := sess.TrackRequest(msg.ReqID)
+
+	// Unknown commands share one label to keep metric cardinality bounded
+	command := msg.Cmd
+	err = h.dispatchCommand(sess, msg, data)
+	if err == errUnknownCommand {
+		command = "unknown"
+		err = sess.RespondError(msg.ReqID, "Unknown command", nil)
+	}
+
+	failed := done() || err != nil
+	duration := time.Since(start)
+
+	metrics.CommandsTotal.WithLabelValues(command).Inc()
+	metrics.CommandDuration.WithLabelValues(command).Observe(duration.Seconds())
+	if failed {
+		metrics.CommandErrorsTotal.WithLabelValues(command).Inc()
+	}
+
+	// Heartbeats arrive every few seconds per client and would drown out
+	// everything else at info level
+	level := slog.LevelInfo
+	if msg.Cmd == "heartbeat" {
+		level = slog.LevelDebug
+	}
+	attrs := []any{"duration", duration, "failed", failed}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	msg.Logger(sess).Log(context.Background(), level, "Handled command", attrs...)
+
+	return err
+}
+
+// dispatchCommand routes a parsed request to its handler
+func (h *WebSocketHandler) dispatchCommand(sess *chat.Session, msg *WSRequest, data []byte) error {
+	if ok, err := checkBotCommand(sess, msg); !ok {
+		return err
+	}
 
 	switch msg.Cmd {
+	case "hello":
+		return h.HandleHello(sess, data)
 	case "login":
 		return h.HandleLogin(sess, data)
 	case "logout":
@@ -211,22 +325,68 @@ func (h *WebSocketHandler) handleMessage(sess *chat.Session, data []byte) error
 		return h.HandleMyChannels(sess, data)
 	case "get_history":
 		return h.HandleHistory(sess, data)
+	case "get_thread":
+		return h.HandleGetThread(sess, data)
 	case "announce":
 		return h.HandleAnnounce(sess, data)
 	case "channel_users":
 		return h.HandleChannelUsers(sess, data)
+	case "create_webhook":
+		return h.HandleCreateWebhook(sess, data)
+	case "list_webhooks":
+		return h.HandleListWebhooks(sess, data)
+	case "revoke_webhook":
+		return h.HandleRevokeWebhook(sess, data)
+	case "create_outgoing_webhook":
+		return h.HandleCreateOutgoingWebhook(sess, data)
+	case "list_outgoing_webhooks":
+		return h.HandleListOutgoingWebhooks(sess, data)
+	case "revoke_outgoing_webhook":
+		return h.HandleRevokeOutgoingWebhook(sess, data)
+	case "webhook_deliveries":
+		return h.HandleWebhookDeliveries(sess, data)
+	case "mentions":
+		return h.HandleMentions(sess, data)
+	case "highlights":
+		return h.HandleHighlights(sess, data)
+	case "set_highlights":
+		return h.HandleSetHighlights(sess, data)
+	case "react":
+		return h.HandleReact(sess, data)
+	case "unreact":
+		return h.HandleUnreact(sess, data)
+	case "pin":
+		return h.HandlePin(sess, data)
+	case "unpin":
+		return h.HandleUnpin(sess, data)
+	case "pins":
+		return h.HandlePins(sess, data)
+	case "mark_read":
+		return h.HandleMarkRead(sess, data)
+	case "typing":
+		return h.HandleTyping(sess, data)
+	case "raw":
+		return h.HandleRaw(sess, data)
+	case "commands":
+		return h.HandleCommands(sess, data)
 	default:
-		return sess.RespondError(msg.ReqID, "Unknown command", nil)
+		return errUnknownCommand
 	}
 }
 
 // handleUnexpectedDisconnect generates leave events when a session disconnects unexpectedly
-func (h *WebSocketHandler) handleUnexpectedDisconnect(sessionID string) {
+func (h *WebSocketHandler) handleUnexpectedDisconnect(sessionID string, conn chat.Conn) {
 	session := h.sessions.GetSession(sessionID)
 	if session == nil {
 		return
 	}
 
+	// The session moved to a new connection (possibly on another transport)
+	// and is still around
+	if !session.HasConn(conn) {
+		return
+	}
+
 	// Check if user was logged in
 	if session.UserID == nil || session.Nickname == nil {
 		// Not logged in, just remove the session normally
@@ -238,31 +398,34 @@ func (h *WebSocketHandler) handleUnexpectedDisconnect(sessionID string) {
 	nickname := *session.Nickname
 	channels := session.GetChannels()
 
-	log.Printf("Generating leave events for unexpected disconnect of user %s (ID: %d)", nickname, userID)
+	session.Logger().Info("Generating leave events for unexpected disconnect", "nickname", nickname)
 
 	// Send leave events to all channels the user was in
 	for _, channelID := range channels {
 		// Create database record
-		_, err := models.CreateMessage(h.db, &channelID, userID, "connection lost", "left", nickname, false)
+		leaveMessage, err := models.CreateMessage(h.db, &channelID, userID, "connection lost", "left", nickname, false)
 		if err != nil {
-			log.Printf("Failed to create leave message for channel %d: %v", channelID, err)
+			session.Logger().Error("Failed to create leave message", "channel_id", channelID, "error", err)
 			continue
 		}
+		h.hooks.Dispatch(leaveMessage)
 
 		// Remove operator status if user was an op
 		err = models.RemoveUserOp(h.db, userID, channelID)
 		if err != nil {
-			log.Printf("Failed to remove op status for user %d in channel %d: %v", userID, channelID, err)
+			session.Logger().Error("Failed to remove op status", "channel_id", channelID, "error", err)
 		}
 
 		// Broadcast leave event to other users in the channel
 		leaveEvent := WSEvent{
 			Type:      "event",
+			ID:        leaveMessage.ID,
 			ChannelID: channelID,
 			Event:     "left",
 			UserID:    userID,
 			Nickname:  nickname,
 			SentAt:    time.Now().UTC().Format(time.RFC3339),
+			Reason:    leaveMessage.Message,
 		}
 
 		h.sessions.BroadcastToChannel(channelID, leaveEvent)
@@ -272,6 +435,17 @@ func (h *WebSocketHandler) handleUnexpectedDisconnect(sessionID string) {
 	h.sessions.DisconnectSession(sessionID)
 }
 
+// resumeSession moves a session onto a new connection. Leave events were
+// generated when the previous connection was lost, so join events are sent
+// unless the session switches over from a connection that is still open.
+func (h *WebSocketHandler) resumeSession(session *chat.Session, conn chat.Conn, remoteIP string) {
+	wasConnected := session.Snapshot().Connected
+	h.sessions.TransferConnection(session.ID, conn, remoteIP)
+	if !wasConnected {
+		h.generateJoinEventsForSessionRestore(session)
+	}
+}
+
 // generateJoinEventsForSessionRestore generates join events when a disconnected session reconnects
 func (h *WebSocketHandler) generateJoinEventsForSessionRestore(session *chat.Session) {
 	// Only generate events if user is logged in
@@ -287,7 +461,7 @@ func (h *WebSocketHandler) generateJoinEventsForSessionRestore(session *chat.Ses
 		return
 	}
 
-	log.Printf("Generating join events for session restore of user %s (ID: %d) in %d channels", nickname, userID, len(channels))
+	session.Logger().Info("Generating join events for session restore", "nickname", nickname, "channels", len(channels))
 
 	// Send join events to all channels the user is in
 	for _, channelID := range channels {
@@ -323,31 +497,34 @@ func (h *WebSocketHandler) handleExpiredSession(sessionID string) {
 	nickname := *session.Nickname
 	channels := session.GetChannels()
 
-	log.Printf("Generating leave events for expired session of user %s (ID: %d)", nickname, userID)
+	session.Logger().Info("Generating leave events for expired session", "nickname", nickname)
 
 	// Send leave events to all channels the user was in
 	for _, channelID := range channels {
 		// Create database record
-		_, err := models.CreateMessage(h.db, &channelID, userID, "timed out", "left", nickname, false)
+		leaveMessage, err := models.CreateMessage(h.db, &channelID, userID, "timed out", "left", nickname, false)
 		if err != nil {
-			log.Printf("Failed to create leave message for channel %d: %v", channelID, err)
+			session.Logger().Error("Failed to create leave message", "channel_id", channelID, "error", err)
 			continue
 		}
+		h.hooks.Dispatch(leaveMessage)
 
 		// Remove operator status if user was an op
 		err = models.RemoveUserOp(h.db, userID, channelID)
 		if err != nil {
-			log.Printf("Failed to remove op status for user %d in channel %d: %v", userID, channelID, err)
+			session.Logger().Error("Failed to remove op status", "channel_id", channelID, "error", err)
 		}
 
 		// Broadcast leave event to other users in the channel
 		leaveEvent := WSEvent{
 			Type:      "event",
+			ID:        leaveMessage.ID,
 			ChannelID: channelID,
 			Event:     "left",
 			UserID:    userID,
 			Nickname:  nickname,
 			SentAt:    time.Now().UTC().Format(time.RFC3339),
+			Reason:    leaveMessage.Message,
 		}
 
 		h.sessions.BroadcastToChannel(channelID, leaveEvent)
@@ -356,3 +533,53 @@ func (h *WebSocketHandler) handleExpiredSession(sessionID string) {
 	// For logged-in users, disconnect but keep session alive for potential reconnection
 	h.sessions.DisconnectSession(sessionID)
 }
+
+// terminateSession generates leave events for a session and removes it for
+// good, so it cannot be resumed
+func (h *WebSocketHandler) terminateSession(sessionID string, reason string) bool {
+	session := h.sessions.GetSession(sessionID)
+	if session == nil {
+		return false
+	}
+
+	if session.UserID != nil && session.Nickname != nil {
+		userID := *session.UserID
+		nickname := *session.Nickname
+
+		session.Logger().Info("Generating leave events for terminated session", "nickname", nickname, "reason", reason)
+
+		for _, channelID := range session.GetChannels() {
+			// Unsubscribe first so the leave event does not go to the
+			// session that is being removed
+			session.LeaveChannel(channelID)
+
+			leaveMessage, err := models.CreateMessage(h.db, &channelID, userID, reason, "left", nickname, false)
+			if err != nil {
+				session.Logger().Error("Failed to create leave message", "channel_id", channelID, "error", err)
+				continue
+			}
+			h.hooks.Dispatch(leaveMessage)
+
+			// Remove operator status if user was an op
+			err = models.RemoveUserOp(h.db, userID, channelID)
+			if err != nil {
+				session.Logger().Error("Failed to remove op status", "channel_id", channelID, "error", err)
+			}
+
+			leaveEvent := WSEvent{
+				Type:      "event",
+				ID:        leaveMessage.ID,
+				ChannelID: channelID,
+				Event:     "left",
+				UserID:    userID,
+				Nickname:  nickname,
+				SentAt:    time.Now().UTC().Format(time.RFC3339),
+				Reason:    reason,
+			}
+			h.sessions.BroadcastToChannel(channelID, leaveEvent)
+		}
+	}
+
+	h.sessions.RemoveSession(sessionID)
+	return true
+}
@@ -1,10 +1,10 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
+	"throwback-chat/internal/logging"
 	"throwback-chat/internal/models"
 )
 
@@ -57,7 +57,7 @@ func (h *WebSocketHandler) HandleAnnounce(sess *chat.Session, data []byte) error
 		}
 
 		// Create announcement event in database
-		_, err = models.CreateMessage(h.db, req.ChannelID, *sess.UserID, req.Message, "announcement", *sess.Nickname, false)
+		dbMessage, err := models.CreateMessage(h.db, req.ChannelID, *sess.UserID, req.Message, "announcement", *sess.Nickname, false)
 		if err != nil {
 			return sess.RespondError(req.ReqID, "Failed to create announcement", err)
 		}
@@ -65,16 +65,18 @@ func (h *WebSocketHandler) HandleAnnounce(sess *chat.Session, data []byte) error
 		// Broadcast announcement event to all users in the channel
 		announceEvent := WSEvent{
 			Type:      "event",
+			ID:        dbMessage.ID,
 			ChannelID: *req.ChannelID,
 			Event:     "announcement",
 			UserID:    *sess.UserID,
 			Nickname:  *sess.Nickname,
 			SentAt:    time.Now().Format(time.RFC3339),
+			Message:   req.Message,
 		}
 		h.sessions.BroadcastToChannel(*req.ChannelID, announceEvent)
 
-		log.Printf("User %s made channel announcement in channel %s (ID: %d): %s",
-			*sess.Nickname, channel.Name, channel.ID, req.Message)
+		req.Logger(sess).Info("User made channel announcement",
+			"nickname", *sess.Nickname, "channel", channel.Name, "channel_id", channel.ID, logging.Content(req.Message))
 
 		return sess.RespondSuccess(req.ReqID, WSAnnounceResponse{
 			ChannelID: req.ChannelID,
@@ -95,7 +97,7 @@ func (h *WebSocketHandler) HandleAnnounce(sess *chat.Session, data []byte) error
 		}
 
 		// Create server announcement event in database (no channel_id)
-		_, err = models.CreateMessage(h.db, nil, *sess.UserID, req.Message, "announcement", *sess.Nickname, false)
+		dbMessage, err := models.CreateMessage(h.db, nil, *sess.UserID, req.Message, "announcement", *sess.Nickname, false)
 		if err != nil {
 			return sess.RespondError(req.ReqID, "Failed to create announcement", err)
 		}
@@ -103,15 +105,17 @@ func (h *WebSocketHandler) HandleAnnounce(sess *chat.Session, data []byte) error
 		// Broadcast announcement event to all connected users
 		announceEvent := WSEvent{
 			Type:      "event",
+			ID:        dbMessage.ID,
 			ChannelID: 0, // 0 indicates server-wide announcement
 			Event:     "announcement",
 			UserID:    *sess.UserID,
 			Nickname:  *sess.Nickname,
 			SentAt:    time.Now().Format(time.RFC3339),
+			Message:   req.Message,
 		}
 		h.sessions.BroadcastToAll(announceEvent)
 
-		log.Printf("User %s made server-wide announcement: %s", *sess.Nickname, req.Message)
+		req.Logger(sess).Info("User made server-wide announcement", "nickname", *sess.Nickname, logging.Content(req.Message))
 
 		return sess.RespondSuccess(req.ReqID, WSAnnounceResponse{
 			ChannelID: nil,
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/utils"
+)
+
+// botInfo converts a bot account into the restrictions tracked on its sessions
+func botInfo(bot *models.Bot) *chat.BotInfo {
+	return &chat.BotInfo{
+		AllowedChannels: bot.AllowedChannels,
+		AllowedCommands: bot.AllowedCommands,
+	}
+}
+
+// authenticateBot checks the bot token of a WebSocket upgrade request. It
+// returns nil without a token, and writes an HTTP error and returns false if
+// the token is invalid or the bot is already connected.
+func (h *WebSocketHandler) authenticateBot(w http.ResponseWriter, r *http.Request) (*models.Bot, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, true
+	}
+
+	bot, err := models.GetBotByToken(h.db, token)
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return nil, false
+	}
+	if bot == nil {
+		utils.APIError(w, http.StatusUnauthorized, "Invalid bot token", nil)
+		return nil, false
+	}
+
+	for _, session := range h.sessions.GetSessionsByUserID(bot.UserID) {
+		if session.Snapshot().Connected {
+			utils.APIError(w, http.StatusConflict, "Bot is already connected", nil)
+			return nil, false
+		}
+	}
+
+	return bot, true
+}
+
+// attachBotSession logs a bot connection in. A session the bot left behind
+// when its connection dropped is resumed, so it gets its channels back.
+func (h *WebSocketHandler) attachBotSession(bot *models.Bot, conn chat.Conn, remoteIP string) *chat.Session {
+	if err := models.TouchBot(h.db, bot.UserID); err != nil {
+		slog.Error("Failed to record bot connection", "user_id", bot.UserID, "error", err)
+	}
+
+	for _, session := range h.sessions.GetSessionsByUserID(bot.UserID) {
+		session.SetBot(botInfo(bot))
+		h.resumeSession(session, conn, remoteIP)
+		session.Logger().Info("Bot resumed session", "nickname", bot.Nickname)
+		return session
+	}
+
+	session := h.sessions.AddSession(uuid.New().String(), conn, remoteIP)
+	session.SetUser(bot.UserID, bot.Nickname)
+	session.SetBot(botInfo(bot))
+	session.Logger().Info("Bot logged in", "nickname", bot.Nickname)
+	return session
+}
+
+// refreshBotSessions applies changed restrictions to the live sessions of a
+// bot
+func (h *WebSocketHandler) refreshBotSessions(bot *models.Bot) {
+	for _, session := range h.sessions.GetSessionsByUserID(bot.UserID) {
+		session.SetBot(botInfo(bot))
+	}
+}
+
+// checkBotCommand enforces the command restrictions of bot sessions. Bots are
+// logged in by their token, so they can neither log in nor out. Heartbeats
+// and hello are always allowed.
+func checkBotCommand(sess *chat.Session, msg *WSRequest) (bool, error) {
+	bot := sess.Bot()
+	if bot == nil || msg.Cmd == "heartbeat" || msg.Cmd == "hello" {
+		return true, nil
+	}
+
+	switch {
+	case msg.Cmd == "login" || msg.Cmd == "logout":
+		return false, sess.RespondError(msg.ReqID, "Bots cannot log in or out", nil)
+	case !bot.AllowsCommand(msg.Cmd):
+		return false, sess.RespondError(msg.ReqID, "Command not allowed for this bot", nil)
+	}
+	return true, nil
+}
+
+// botDeniesChannel reports whether the session belongs to a bot that may not
+// join the named channel
+func botDeniesChannel(sess *chat.Session, channelName string) bool {
+	bot := sess.Bot()
+	return bot != nil && !bot.AllowsChannel(models.NormalizeChannelName(channelName))
+}
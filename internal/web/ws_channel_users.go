@@ -6,9 +6,8 @@ import (
 )
 
 type ChannelUsersRequest struct {
-	Cmd       string `json:"cmd"`
-	ChannelID int    `json:"channel_id"`
-	ReqID     string `json:"req_id"`
+	WSRequest
+	ChannelID int `json:"channel_id"`
 }
 
 func (h *WebSocketHandler) HandleChannelUsers(sess *chat.Session, data []byte) error {
@@ -45,7 +44,7 @@ func (h *WebSocketHandler) HandleChannelUsers(sess *chat.Session, data []byte) e
 		if activeSession.UserID != nil && activeSession.IsInChannel(req.ChannelID) {
 			// Get user info from database
 			var user models.User
-			err := h.db.ReadDBX().Get(&user, "SELECT id, nickname, is_serv FROM users WHERE id = ?", *activeSession.UserID)
+			err := h.db.ReadDBX().Get(&user, "SELECT id, nickname, is_serv, is_bot FROM users WHERE id = ?", *activeSession.UserID)
 			if err != nil {
 				continue // Skip this user if we can't get their info
 			}
@@ -61,6 +60,7 @@ func (h *WebSocketHandler) HandleChannelUsers(sess *chat.Session, data []byte) e
 				ID:       user.ID,
 				Nickname: user.Nickname,
 				IsServ:   user.IsServ,
+				IsBot:    user.IsBot,
 				IsOp:     isOp,
 			})
 		}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+type WSHelloRequest struct {
+	WSRequest
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type WSHelloResponse struct {
+	Version      int         `json:"version"`
+	ServerName   string      `json:"server_name"`
+	Capabilities []string    `json:"capabilities"` // supported by the server
+	Enabled      []string    `json:"enabled"`      // enabled for this session
+	Limits       HelloLimits `json:"limits"`
+}
+
+// HelloLimits tells clients the bounds the server enforces
+type HelloLimits struct {
+	ChannelNameLength int   `json:"channel_name_length"`
+	HistoryPageSize   int   `json:"history_page_size"`
+	PlaybackMessages  int   `json:"playback_messages"`
+	HeartbeatTimeout  int   `json:"heartbeat_timeout"` // seconds
+	TypingTimeout     int   `json:"typing_timeout"`    // seconds
+	AttachmentSize    int64 `json:"attachment_size"`   // bytes, zero if uploads are disabled
+}
+
+// HandleHello negotiates the protocol version and capabilities. It can be
+// sent at any time, each hello replaces the capabilities enabled before.
+// Unknown capabilities are ignored, the response lists what was enabled.
+func (h *WebSocketHandler) HandleHello(sess *chat.Session, data []byte) error {
+	var req WSHelloRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	if req.Version <= 0 {
+		return sess.RespondError(req.ReqID, "Protocol version is required", nil)
+	}
+
+	enabled := sess.SetCapabilities(req.Capabilities)
+
+	req.Logger(sess).Debug("Negotiated capabilities", "client_version", req.Version, "capabilities", enabled)
+
+	// A newer client gets the server's version and has to fall back to it
+	return sess.RespondSuccess(req.ReqID, WSHelloResponse{
+		Version:      min(req.Version, chat.ProtocolVersion),
+		ServerName:   h.serverName,
+		Capabilities: chat.SupportedCapabilities,
+		Enabled:      enabled,
+		Limits: HelloLimits{
+			ChannelNameLength: models.MaxChannelNameLength,
+			HistoryPageSize:   models.MaxHistoryLimit,
+			PlaybackMessages:  joinPlaybackLimit,
+			HeartbeatTimeout:  int(chat.HeartbeatTimeout.Seconds()),
+			TypingTimeout:     int(chat.TypingTimeout.Seconds()),
+			AttachmentSize:    h.attachmentMaxSize,
+		},
+	})
+}
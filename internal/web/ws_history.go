@@ -64,35 +64,9 @@ func (h *WebSocketHandler) HandleHistory(sess *chat.Session, data []byte) error
 
 	// Convert messages to WebSocket format
 	var responseMessages []interface{}
+	page := h.newHistoryPage(sess, req.ChannelID, messages)
 	for _, msg := range messages {
-		if msg.Event != "" && msg.Event != "message" {
-			// Send as event
-			eventMsg := WSEvent{
-				Type:      "event",
-				ChannelID: req.ChannelID,
-				Event:     msg.Event,
-				UserID:    msg.UserID,
-				Nickname:  msg.Nickname,
-				SentAt:    msg.SentAt.Format(time.RFC3339),
-			}
-			// For topic_change events, include the topic from the message content
-			if msg.Event == "topic_change" && msg.Message != "" {
-				eventMsg.Topic = &msg.Message
-			}
-			responseMessages = append(responseMessages, eventMsg)
-		} else {
-			// Send as regular message
-			chatMsg := WSMessage{
-				Type:      "message",
-				ChannelID: req.ChannelID,
-				Message:   msg.Message,
-				IsPassive: msg.IsPassive,
-				SentAt:    msg.SentAt.Format(time.RFC3339),
-				UserID:    msg.UserID,
-				Nickname:  msg.Nickname,
-			}
-			responseMessages = append(responseMessages, chatMsg)
-		}
+		responseMessages = append(responseMessages, page.payload(msg).ForSession(sess))
 	}
 
 	// Check if there are more messages available
@@ -138,3 +112,119 @@ func (h *WebSocketHandler) HandleHistory(sess *chat.Session, data []byte) error
 
 	return sess.RespondSuccess(req.ReqID, response)
 }
+
+// historyPage converts stored messages for one session, together with what
+// is stored alongside them, which is loaded for the whole page at once
+type historyPage struct {
+	channelID int
+	batch     string // batch the messages are sent in, if any
+
+	attachments map[int][]*models.Attachment
+	previews    map[int][]models.LinkPreview
+	reactions   map[int][]models.ReactionSummary
+	threads     map[int]models.ThreadSummary
+}
+
+// newHistoryPage loads what the messages need to be sent to sess. Failing to
+// load it is logged and leaves it out.
+func (h *WebSocketHandler) newHistoryPage(sess *chat.Session, channelID int, messages []*models.Message) *historyPage {
+	page := &historyPage{channelID: channelID}
+
+	ids := make([]int, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+
+	attachments, err := models.GetMessageAttachments(h.db, ids)
+	if err != nil {
+		sess.Logger().Error("Failed to load attachments", "channel_id", channelID, "error", err)
+	}
+	page.attachments = attachments
+
+	previews, err := models.GetMessagePreviews(h.db, ids)
+	if err != nil {
+		sess.Logger().Error("Failed to load link previews", "channel_id", channelID, "error", err)
+	}
+	page.previews = previews
+
+	reactions, err := models.GetReactions(h.db, ids, *sess.UserID)
+	if err != nil {
+		sess.Logger().Error("Failed to load reactions", "channel_id", channelID, "error", err)
+	}
+	page.reactions = reactions
+
+	threads, err := models.GetThreadSummaries(h.db, ids)
+	if err != nil {
+		sess.Logger().Error("Failed to load thread summaries", "channel_id", channelID, "error", err)
+	}
+	page.threads = threads
+
+	return page
+}
+
+// payload converts a stored message to what clients get live: an event for
+// joins, topic changes and the like, a message otherwise
+func (p *historyPage) payload(msg *models.Message) chat.Negotiated {
+	if msg.Event != "" && msg.Event != "message" {
+		eventMsg := WSEvent{
+			Type:      "event",
+			ID:        msg.ID,
+			ChannelID: p.channelID,
+			Event:     msg.Event,
+			UserID:    msg.UserID,
+			Nickname:  msg.Nickname,
+			SentAt:    msg.SentAt.Format(time.RFC3339),
+			Batch:     p.batch,
+		}
+		// What the event is about is stored as the message content
+		switch msg.Event {
+		case "topic_change":
+			// Cleared topics are stored as "Topic cleared", and sent live
+			// as empty topics
+			topic := msg.Message
+			if topic == topicClearedMessage {
+				topic = ""
+			}
+			eventMsg.Topic = &topic
+		case "announcement":
+			eventMsg.Message = msg.Message
+		case "left", "kicked":
+			eventMsg.Reason = msg.Message
+		case "nick_change":
+			// Nick changes from before old nicknames were stored have none
+			eventMsg.OldNickname = msg.Message
+			eventMsg.NewNickname = msg.Nickname
+		}
+		if msg.ActorID != nil {
+			eventMsg.ActorID = *msg.ActorID
+			eventMsg.ActorNickname = msg.ActorNickname
+		}
+		return eventMsg
+	}
+
+	wsMessage := WSMessage{
+		Type:           "message",
+		ID:             msg.ID,
+		ChannelID:      p.channelID,
+		Message:        msg.Message,
+		IsPassive:      msg.IsPassive,
+		SentAt:         msg.SentAt.Format(time.RFC3339),
+		UserID:         msg.UserID,
+		Nickname:       msg.Nickname,
+		Batch:          p.batch,
+		HTML:           msg.HTML,
+		Plain:          msg.Plain,
+		ReplyBroadcast: msg.ReplyBroadcast,
+		Attachments:    attachmentPayloads(p.attachments[msg.ID]),
+		Previews:       p.previews[msg.ID],
+		Reactions:      p.reactions[msg.ID],
+	}
+	if msg.ReplyTo != nil {
+		wsMessage.ReplyTo = *msg.ReplyTo
+	}
+	if thread, ok := p.threads[msg.ID]; ok {
+		wsMessage.ReplyCount = thread.ReplyCount
+		wsMessage.LastReplyAt = thread.LastReplyAt.Format(time.RFC3339)
+	}
+	return wsMessage
+}
@@ -1,13 +1,17 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
 	"throwback-chat/internal/models"
+
+	"github.com/google/uuid"
 )
 
+// joinPlaybackLimit is how many recent messages and events a join sends
+const joinPlaybackLimit = 100
+
 type WSJoinRequest struct {
 	WSRequest
 	ChannelName string `json:"channel_name,omitempty"`
@@ -15,8 +19,9 @@ type WSJoinRequest struct {
 }
 
 type WSJoinResponse struct {
-	ChannelID   int    `json:"channel_id"`
-	ChannelName string `json:"channel_name"`
+	ChannelID   int           `json:"channel_id"`
+	ChannelName string        `json:"channel_name"`
+	Pins        []*models.Pin `json:"pins,omitempty"` // with pins only
 }
 
 func (h *WebSocketHandler) HandleJoin(sess *chat.Session, data []byte) error {
@@ -35,6 +40,10 @@ func (h *WebSocketHandler) HandleJoin(sess *chat.Session, data []byte) error {
 
 	// Find or create channel
 	if req.ChannelName != "" {
+		if botDeniesChannel(sess, req.ChannelName) {
+			return sess.RespondError(req.ReqID, "Channel not allowed for this bot", nil)
+		}
+
 		channel, err = models.GetChannelByName(h.db, req.ChannelName)
 		if err != nil {
 			return sess.RespondError(req.ReqID, "Database error", err)
@@ -54,6 +63,9 @@ func (h *WebSocketHandler) HandleJoin(sess *chat.Session, data []byte) error {
 		if channel == nil {
 			return sess.RespondError(req.ReqID, "Channel not found", nil)
 		}
+		if botDeniesChannel(sess, channel.Name) {
+			return sess.RespondError(req.ReqID, "Channel not allowed for this bot", nil)
+		}
 	} else {
 		return sess.RespondError(req.ReqID, "Channel name or ID required", nil)
 	}
@@ -69,23 +81,29 @@ func (h *WebSocketHandler) HandleJoin(sess *chat.Session, data []byte) error {
 	// Check if channel is empty and make user op if so
 	isEmpty, err := models.IsChannelEmpty(h.db, channel.ID)
 	if err != nil {
-		log.Printf("Failed to check if channel %d is empty: %v", channel.ID, err)
+		req.Logger(sess).Error("Failed to check if channel is empty", "channel_id", channel.ID, "error", err)
 	} else if isEmpty {
 		err = models.MakeUserOp(h.db, *sess.UserID, channel.ID, 1) // ChanServ grants op
 		if err != nil {
-			log.Printf("Failed to make user %d op in channel %d: %v", *sess.UserID, channel.ID, err)
+			req.Logger(sess).Error("Failed to make user op", "channel_id", channel.ID, "error", err)
 		}
 	}
 
 	// Create join event in database
-	_, err = models.CreateMessage(h.db, &channel.ID, *sess.UserID, "", "joined", *sess.Nickname, false)
+	dbMessage, err := models.CreateMessage(h.db, &channel.ID, *sess.UserID, "", "joined", *sess.Nickname, false)
 	if err != nil {
-		log.Printf("Failed to create join message for user %d in channel %d: %v", *sess.UserID, channel.ID, err)
+		req.Logger(sess).Error("Failed to create join message", "channel_id", channel.ID, "error", err)
+	}
+	h.hooks.Dispatch(dbMessage)
+
+	if err := models.InitReadMarker(h.db, *sess.UserID, channel.ID); err != nil {
+		req.Logger(sess).Error("Failed to set read marker", "channel_id", channel.ID, "error", err)
 	}
 
 	// Broadcast join event to all users in the channel
 	joinEvent := WSEvent{
 		Type:      "event",
+		ID:        messageID(dbMessage),
 		ChannelID: channel.ID,
 		Event:     "joined",
 		UserID:    *sess.UserID,
@@ -94,53 +112,47 @@ func (h *WebSocketHandler) HandleJoin(sess *chat.Session, data []byte) error {
 	}
 	h.sessions.BroadcastToChannel(channel.ID, joinEvent)
 
-	// Send initial room content (last 100 messages and events)
+	// Send initial room content (last messages and events)
 	historyOptions := models.MessageHistoryOptions{
-		Limit: 100,
+		Limit: joinPlaybackLimit,
 	}
 	recentMessages, err := models.GetMessageHistory(h.db, channel.ID, historyOptions)
 	if err != nil {
-		log.Printf("Failed to fetch recent messages for channel %d: %v", channel.ID, err)
+		req.Logger(sess).Error("Failed to fetch recent messages", "channel_id", channel.ID, "error", err)
 	} else {
+		page := h.newHistoryPage(sess, channel.ID, recentMessages)
+
+		// Clients with batch get the playback wrapped so they can tell it
+		// apart from live traffic
+		if sess.HasCapability(chat.CapBatch) {
+			page.batch = uuid.New().String()
+			sess.SendMessage(WSBatch{Type: "batch", ID: page.batch, State: "start", BatchType: "playback", ChannelID: channel.ID})
+		}
+
 		// Send messages in chronological order (reverse the DESC order from DB)
 		for i := len(recentMessages) - 1; i >= 0; i-- {
-			msg := recentMessages[i]
-
-			if msg.Event != "" && msg.Event != "message" {
-				// Send as event
-				eventMsg := WSEvent{
-					Type:      "event",
-					ChannelID: channel.ID,
-					Event:     msg.Event,
-					UserID:    msg.UserID,
-					Nickname:  msg.Nickname,
-					SentAt:    msg.SentAt.Format(time.RFC3339),
-				}
-				// For topic_change events, include the topic from the message content
-				if msg.Event == "topic_change" && msg.Message != "" {
-					eventMsg.Topic = &msg.Message
-				}
-				sess.SendMessage(eventMsg)
-			} else {
-				// Send as regular message
-				chatMsg := WSMessage{
-					Type:      "message",
-					ChannelID: channel.ID,
-					Message:   msg.Message,
-					IsPassive: msg.IsPassive,
-					SentAt:    msg.SentAt.Format(time.RFC3339),
-					UserID:    msg.UserID,
-					Nickname:  msg.Nickname,
-				}
-				sess.SendMessage(chatMsg)
-			}
+			sess.SendMessage(page.payload(recentMessages[i]))
+		}
+
+		if page.batch != "" {
+			sess.SendMessage(WSBatch{Type: "batch", ID: page.batch, State: "end", ChannelID: channel.ID})
+		}
+	}
+
+	var pins []*models.Pin
+	if sess.HasCapability(chat.CapPins) {
+		pins, err = models.GetPins(h.db, channel.ID)
+		if err != nil {
+			req.Logger(sess).Error("Failed to fetch pinned messages", "channel_id", channel.ID, "error", err)
+			pins = []*models.Pin{}
 		}
 	}
 
-	log.Printf("User %s joined channel %s (ID: %d)", *sess.Nickname, channel.Name, channel.ID)
+	req.Logger(sess).Info("User joined channel", "nickname", *sess.Nickname, "channel", channel.Name, "channel_id", channel.ID)
 
 	return sess.RespondSuccess(req.ReqID, WSJoinResponse{
 		ChannelID:   channel.ID,
 		ChannelName: channel.Name,
+		Pins:        pinsForSession(sess, pins),
 	})
 }
@@ -1,10 +1,10 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
+	"throwback-chat/internal/logging"
 	"throwback-chat/internal/models"
 )
 
@@ -98,24 +98,29 @@ func (h *WebSocketHandler) HandleKick(sess *chat.Session, data []byte) error {
 	}
 
 	// Create kick event in database
-	_, err = models.CreateMessage(h.db, &req.ChannelID, req.UserID, kickMessage, "kicked", targetUser.Nickname, false)
+	dbMessage, err := models.CreateActorEvent(h.db, req.ChannelID, req.UserID, kickMessage, "kicked", targetUser.Nickname, *sess.UserID, *sess.Nickname)
 	if err != nil {
-		log.Printf("Failed to create kick message: %v", err)
+		req.Logger(sess).Error("Failed to create kick message", "channel_id", req.ChannelID, "error", err)
 	}
 
 	// Broadcast kick event to all users in the channel
 	kickEvent := WSEvent{
 		Type:      "event",
+		ID:        messageID(dbMessage),
 		ChannelID: req.ChannelID,
 		Event:     "kicked",
 		UserID:    req.UserID,
 		Nickname:  targetUser.Nickname,
 		SentAt:    time.Now().Format(time.RFC3339),
+
+		Reason:        kickMessage,
+		ActorID:       *sess.UserID,
+		ActorNickname: *sess.Nickname,
 	}
 	h.sessions.BroadcastToChannel(req.ChannelID, kickEvent)
 
-	log.Printf("User %s kicked user %s from channel %s (ID: %d). Reason: %s",
-		*sess.Nickname, targetUser.Nickname, channel.Name, channel.ID, kickMessage)
+	req.Logger(sess).Info("User kicked user from channel",
+		"nickname", *sess.Nickname, "target", targetUser.Nickname, "channel", channel.Name, "channel_id", channel.ID, logging.Content(kickMessage))
 
 	return sess.RespondSuccess(req.ReqID, WSKickResponse{
 		UserID:    req.UserID,
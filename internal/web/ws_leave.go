@@ -1,7 +1,6 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
@@ -60,6 +59,7 @@ func (h *WebSocketHandler) HandleLeave(sess *chat.Session, data []byte) error {
 
 	// Remove user from channel subscription
 	sess.LeaveChannel(channel.ID)
+	h.typing.Stop(channel.ID, *sess.UserID)
 
 	// Create leave event message
 	leaveMessage := ""
@@ -68,36 +68,39 @@ func (h *WebSocketHandler) HandleLeave(sess *chat.Session, data []byte) error {
 	}
 
 	// Create leave event in database
-	_, err = models.CreateMessage(h.db, &channel.ID, *sess.UserID, leaveMessage, "left", *sess.Nickname, false)
+	dbMessage, err := models.CreateMessage(h.db, &channel.ID, *sess.UserID, leaveMessage, "left", *sess.Nickname, false)
 	if err != nil {
-		log.Printf("Failed to create leave message: %v", err)
+		req.Logger(sess).Error("Failed to create leave message", "channel_id", channel.ID, "error", err)
 	}
+	h.hooks.Dispatch(dbMessage)
 
 	// Broadcast leave event to all users in the channel
 	leaveEvent := WSEvent{
 		Type:      "event",
+		ID:        messageID(dbMessage),
 		ChannelID: channel.ID,
 		Event:     "left",
 		UserID:    *sess.UserID,
 		Nickname:  *sess.Nickname,
 		SentAt:    time.Now().Format(time.RFC3339),
+		Reason:    leaveMessage,
 	}
 	h.sessions.BroadcastToChannel(channel.ID, leaveEvent)
 
 	// Remove operator status if user was an op
 	err = models.RemoveUserOp(h.db, *sess.UserID, channel.ID)
 	if err != nil {
-		log.Printf("Failed to remove op status for user %d in channel %d: %v", *sess.UserID, channel.ID, err)
+		req.Logger(sess).Error("Failed to remove op status", "channel_id", channel.ID, "error", err)
 	}
 
 	// Attempt to clean up the channel if it's now empty
 	if err := models.DeleteEmptyChannel(h.db, channel.ID); err != nil {
-		log.Printf("Failed to cleanup empty channel %d: %v", channel.ID, err)
+		req.Logger(sess).Error("Failed to cleanup empty channel", "channel_id", channel.ID, "error", err)
 	} else {
-		log.Printf("Channel %s (ID: %d) was cleaned up as it's now empty", channel.Name, channel.ID)
+		req.Logger(sess).Debug("Cleaned up channel if empty", "channel", channel.Name, "channel_id", channel.ID)
 	}
 
-	log.Printf("User %s left channel %s (ID: %d)", *sess.Nickname, channel.Name, channel.ID)
+	req.Logger(sess).Info("User left channel", "nickname", *sess.Nickname, "channel", channel.Name, "channel_id", channel.ID)
 
 	return sess.RespondSuccess(req.ReqID, WSLeaveResponse{
 		ChannelID:   channel.ID,
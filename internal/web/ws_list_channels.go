@@ -1,8 +1,6 @@
 package web
 
 import (
-	"log"
-
 	"throwback-chat/internal/chat"
 	"throwback-chat/internal/models"
 )
@@ -28,15 +26,19 @@ func (h *WebSocketHandler) HandleListChannels(sess *chat.Session, data []byte) e
 
 	// Get all channels from database
 	var dbChannels []models.Channel
-	err := h.db.ReadDBX().Select(&dbChannels, "SELECT id, name, topic FROM channels ORDER BY name")
+	err := h.db.ReadDBX().Select(&dbChannels, "SELECT id, name, topic, is_secret, is_private FROM channels ORDER BY name")
 	if err != nil {
-		log.Printf("Failed to get channels: %v", err)
-		return sess.RespondError(req.ReqID, "Failed to retrieve channel list", nil)
+		return sess.RespondError(req.ReqID, "Failed to retrieve channel list", err)
 	}
 
 	// Build channel info with session-based user counts
 	var channels []models.ChannelInfo
 	for _, channel := range dbChannels {
+		// Secret channels are only listed for their members
+		if channel.IsSecret && !sess.IsInChannel(channel.ID) {
+			continue
+		}
+
 		// Get current user count from session state (not database reconstruction)
 		userCount := h.sessions.GetChannelUserCount(channel.ID)
 
@@ -45,10 +47,12 @@ func (h *WebSocketHandler) HandleListChannels(sess *chat.Session, data []byte) e
 			Name:      channel.Name,
 			Topic:     channel.Topic,
 			UserCount: userCount,
+			IsSecret:  channel.IsSecret,
+			IsPrivate: channel.IsPrivate,
 		})
 	}
 
-	log.Printf("User %s requested channel list, returning %d channels with session-based user counts", *sess.Nickname, len(channels))
+	req.Logger(sess).Debug("Returning channel list with session-based user counts", "channels", len(channels))
 
 	return sess.RespondSuccess(req.ReqID, WSListChannelsResponse{
 		Channels: channels,
@@ -1,8 +1,6 @@
 package web
 
 import (
-	"log"
-
 	"throwback-chat/internal/chat"
 	"throwback-chat/internal/models"
 )
@@ -46,10 +44,15 @@ func (h *WebSocketHandler) HandleLogin(sess *chat.Session, data []byte) error {
 		return sess.RespondError(req.ReqID, "Database error", err)
 	}
 
+	// Bot nicknames can only be used with the bot's token
+	if user.IsBot {
+		return sess.RespondError(req.ReqID, "Nickname is reserved for a bot", nil)
+	}
+
 	// Set user in session
 	sess.SetUser(user.ID, user.Nickname)
 
-	log.Printf("User %s (ID: %d) logged in on session %s", user.Nickname, user.ID, sess.ID)
+	req.Logger(sess).Info("User logged in", "nickname", user.Nickname)
 
 	return sess.RespondSuccess(req.ReqID, WSLoginResponse{
 		UserID:    user.ID,
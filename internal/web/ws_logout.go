@@ -1,7 +1,6 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
@@ -42,16 +41,19 @@ func (h *WebSocketHandler) HandleLogout(sess *chat.Session, data []byte) error {
 			leaveMessage = "Logged out"
 		}
 
-		models.CreateMessage(h.db, &channelID, *sess.UserID, leaveMessage, "left", nickname, false)
+		dbMessage, _ := models.CreateMessage(h.db, &channelID, *sess.UserID, leaveMessage, "left", nickname, false)
+		h.hooks.Dispatch(dbMessage)
 
 		// Broadcast leave event to channel
 		leaveEvent := WSEvent{
 			Type:      "event",
+			ID:        messageID(dbMessage),
 			ChannelID: channelID,
 			Event:     "left",
 			UserID:    *sess.UserID,
 			Nickname:  nickname,
 			SentAt:    time.Now().Format(time.RFC3339),
+			Reason:    leaveMessage,
 		}
 		h.sessions.BroadcastToChannel(channelID, leaveEvent)
 
@@ -59,7 +61,7 @@ func (h *WebSocketHandler) HandleLogout(sess *chat.Session, data []byte) error {
 		sess.LeaveChannel(channelID)
 	}
 
-	log.Printf("User %s logged out from session %s", nickname, sess.ID)
+	req.Logger(sess).Info("User logged out", "nickname", nickname)
 
 	// Clear user from session
 	sess.ClearUser()
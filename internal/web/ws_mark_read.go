@@ -0,0 +1,102 @@
+package web
+
+import (
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+type WSMarkReadRequest struct {
+	WSRequest
+	ChannelID int `json:"channel_id"`
+	MessageID int `json:"message_id,omitempty"` // latest message if omitted
+}
+
+type WSMarkReadResponse struct {
+	ChannelID int `json:"channel_id"`
+	models.UnreadState
+}
+
+// WSReadMarkerEvent tells a user's other sessions that a channel was read
+type WSReadMarkerEvent struct {
+	Type      string `json:"type"`
+	ChannelID int    `json:"channel_id"`
+	models.UnreadState
+}
+
+// ForSession skips sessions without read-markers
+func (e WSReadMarkerEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapReadMarkers) {
+		return nil
+	}
+	return e
+}
+
+// HandleMarkRead moves the user's read marker in a channel forward. Markers
+// never move back, so marking an older message is not an error but changes
+// nothing.
+func (h *WebSocketHandler) HandleMarkRead(sess *chat.Session, data []byte) error {
+	var req WSMarkReadRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to mark messages read", nil)
+	}
+
+	if !sess.IsInChannel(req.ChannelID) {
+		return sess.RespondError(req.ReqID, "Not in channel", nil)
+	}
+
+	messageID := req.MessageID
+	if messageID == 0 {
+		latest, err := models.GetLatestMessageID(h.db, req.ChannelID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		messageID = latest
+	} else {
+		message, err := models.GetMessageByID(h.db, messageID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		if message == nil || message.ChannelID == nil || *message.ChannelID != req.ChannelID {
+			return sess.RespondError(req.ReqID, "Message not found in channel", nil)
+		}
+	}
+
+	moved, err := models.MarkRead(h.db, *sess.UserID, req.ChannelID, messageID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Failed to mark read", err)
+	}
+
+	state, err := models.GetUnreadState(h.db, *sess.UserID, req.ChannelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+
+	// The user's other tabs and devices follow along
+	if moved {
+		h.sessions.BroadcastToUser(*sess.UserID, WSReadMarkerEvent{
+			Type:        "read_marker",
+			ChannelID:   req.ChannelID,
+			UnreadState: state,
+		})
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSMarkReadResponse{
+		ChannelID:   req.ChannelID,
+		UnreadState: state,
+	})
+}
+
+// unreadState returns the session user's unread state of a channel, or
+// nothing if it can't be read
+func (h *WebSocketHandler) unreadState(sess *chat.Session, channelID int) models.UnreadState {
+	state, err := models.GetUnreadState(h.db, *sess.UserID, channelID)
+	if err != nil {
+		sess.Logger().Error("Failed to get unread state", "channel_id", channelID, "error", err)
+	}
+	return state
+}
@@ -1,10 +1,10 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
+	"throwback-chat/internal/logging"
 	"throwback-chat/internal/models"
 )
 
@@ -53,16 +53,23 @@ func (h *WebSocketHandler) HandleMe(sess *chat.Session, data []byte) error {
 	// Broadcast passive message to all users in the channel
 	wsMessage := WSMessage{
 		Type:      "message",
+		ID:        dbMessage.ID,
 		ChannelID: req.ChannelID,
 		Message:   req.Message,
 		IsPassive: true, // Always true for /me commands
 		SentAt:    dbMessage.SentAt.Format(time.RFC3339),
 		UserID:    *sess.UserID,
 		Nickname:  *sess.Nickname,
+		HTML:      dbMessage.HTML,
+		Plain:     dbMessage.Plain,
 	}
-	h.sessions.BroadcastToChannel(req.ChannelID, wsMessage)
+	h.typing.Stop(req.ChannelID, *sess.UserID)
+	h.sessions.BroadcastToChannel(req.ChannelID, wsMessage.echoedBy(sess, req.ReqID))
+	h.hooks.Dispatch(dbMessage)
+	h.unfurler.Unfurl(dbMessage)
+	h.notifyMentions(sess, dbMessage, channel)
 
-	log.Printf("Me message sent by %s to channel %d: %s", *sess.Nickname, req.ChannelID, req.Message)
+	req.Logger(sess).Debug("Me message sent", "nickname", *sess.Nickname, "channel_id", req.ChannelID, logging.Content(req.Message))
 
 	return sess.RespondSuccess(req.ReqID, nil)
 }
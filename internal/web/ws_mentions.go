@@ -0,0 +1,222 @@
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+// maxHighlightWordLength bounds a single highlight word
+const maxHighlightWordLength = 50
+
+type WSMentionsRequest struct {
+	WSRequest
+	Limit    int  `json:"limit,omitempty"`
+	Before   *int `json:"before,omitempty"` // mention ID to page back from
+	Unseen   bool `json:"unseen,omitempty"`
+	MarkSeen bool `json:"mark_seen,omitempty"` // mark the returned mentions seen
+}
+
+type WSMentionsResponse struct {
+	Mentions []*models.Mention `json:"mentions"`
+	HasMore  bool              `json:"has_more"`
+}
+
+// WSMentionEvent is pushed to all sessions of a mentioned user, whether or
+// not they are in the channel
+type WSMentionEvent struct {
+	Type string `json:"type"`
+	*models.Mention
+}
+
+// ForSession skips sessions without mentions and drops the renderings of
+// the message for sessions without rendered-text
+func (e WSMentionEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapMentions) {
+		return nil
+	}
+	if !s.HasCapability(chat.CapRendered) {
+		mention := *e.Mention
+		mention.HTML, mention.Plain = "", ""
+		e.Mention = &mention
+	}
+	return e
+}
+
+type WSHighlightsRequest struct {
+	WSRequest
+}
+
+type WSSetHighlightsRequest struct {
+	WSRequest
+	Words []string `json:"words"`
+}
+
+type WSHighlightsResponse struct {
+	Words []string `json:"words"`
+}
+
+// HandleMentions lists the user's mentions, newest first
+func (h *WebSocketHandler) HandleMentions(sess *chat.Session, data []byte) error {
+	var req WSMentionsRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to list mentions", nil)
+	}
+
+	if req.Limit <= 0 || req.Limit > models.MaxHistoryLimit {
+		req.Limit = 50
+	}
+
+	// One extra tells whether there is another page
+	mentions, err := models.GetMentions(h.db, *sess.UserID, models.MentionOptions{
+		Limit:      req.Limit + 1,
+		Before:     req.Before,
+		UnseenOnly: req.Unseen,
+	})
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Failed to retrieve mentions", err)
+	}
+
+	hasMore := len(mentions) > req.Limit
+	if hasMore {
+		mentions = mentions[:req.Limit]
+	}
+
+	if req.MarkSeen {
+		ids := make([]int, 0, len(mentions))
+		for _, mention := range mentions {
+			ids = append(ids, mention.ID)
+		}
+		if err := models.MarkMentionsSeen(h.db, *sess.UserID, ids); err != nil {
+			return sess.RespondError(req.ReqID, "Failed to mark mentions seen", err)
+		}
+	}
+
+	if !sess.HasCapability(chat.CapRendered) {
+		for _, mention := range mentions {
+			mention.HTML, mention.Plain = "", ""
+		}
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSMentionsResponse{
+		Mentions: mentions,
+		HasMore:  hasMore,
+	})
+}
+
+// HandleHighlights returns the user's highlight words
+func (h *WebSocketHandler) HandleHighlights(sess *chat.Session, data []byte) error {
+	var req WSHighlightsRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to get highlight words", nil)
+	}
+
+	words, err := models.GetUserHighlights(h.db, *sess.UserID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSHighlightsResponse{Words: words})
+}
+
+// HandleSetHighlights replaces the user's highlight words. Messages matching
+// one as a whole word, ignoring case, count as mentions.
+func (h *WebSocketHandler) HandleSetHighlights(sess *chat.Session, data []byte) error {
+	var req WSSetHighlightsRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to set highlight words", nil)
+	}
+
+	words := chat.NormalizeHighlightWords(req.Words)
+	if len(words) > chat.MaxHighlightWords {
+		return sess.RespondError(req.ReqID, fmt.Sprintf("At most %d highlight words allowed", chat.MaxHighlightWords), nil)
+	}
+	for _, word := range words {
+		if len(word) > maxHighlightWordLength {
+			return sess.RespondError(req.ReqID, fmt.Sprintf("Highlight words cannot exceed %d characters", maxHighlightWordLength), nil)
+		}
+	}
+
+	if err := models.SetUserHighlights(h.db, *sess.UserID, words); err != nil {
+		return sess.RespondError(req.ReqID, "Failed to set highlight words", err)
+	}
+
+	req.Logger(sess).Info("User set highlight words", "count", len(words))
+
+	return sess.RespondSuccess(req.ReqID, WSHighlightsResponse{Words: words})
+}
+
+// notifyMentions records who a new message mentions and tells them. Only
+// members of the channel are mentioned, by @nickname or by their highlight
+// words. Nobody is mentioned by their own messages.
+func (h *WebSocketHandler) notifyMentions(sess *chat.Session, message *models.Message, channel *models.Channel) {
+	mentioned := make(map[int]bool)
+
+	for _, nickname := range chat.MentionedNicknames(message.Message) {
+		userID, err := models.FindMentionedMember(h.db, channel.ID, nickname)
+		if err != nil {
+			sess.Logger().Error("Failed to look up mentioned user", "nickname", nickname, "error", err)
+			continue
+		}
+		if userID != 0 {
+			mentioned[userID] = true
+		}
+	}
+
+	targets, err := models.GetHighlightTargets(h.db, channel.ID)
+	if err != nil {
+		sess.Logger().Error("Failed to get highlight words", "channel_id", channel.ID, "error", err)
+	}
+	for _, target := range targets {
+		if chat.MatchesHighlight(message.Message, target.Words()) {
+			mentioned[target.UserID] = true
+		}
+	}
+
+	delete(mentioned, message.UserID)
+
+	for userID := range mentioned {
+		mentionID, err := models.CreateMention(h.db, userID, message.ID, channel.ID)
+		if err != nil {
+			sess.Logger().Error("Failed to record mention", "user_id", userID, "message_id", message.ID, "error", err)
+			continue
+		}
+		if mentionID == 0 {
+			continue
+		}
+
+		h.sessions.BroadcastToUser(userID, WSMentionEvent{
+			Type: "mention",
+			Mention: &models.Mention{
+				ID:          mentionID,
+				MessageID:   message.ID,
+				ChannelID:   channel.ID,
+				ChannelName: channel.Name,
+				UserID:      message.UserID,
+				Nickname:    message.Nickname,
+				Message:     message.Message,
+				IsPassive:   message.IsPassive,
+				SentAt:      message.SentAt.UTC().Truncate(time.Second),
+				HTML:        message.HTML,
+				Plain:       message.Plain,
+			},
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package web
 
 import (
-	"log"
+	"fmt"
 	"time"
 
 	"throwback-chat/internal/chat"
+	"throwback-chat/internal/logging"
 	"throwback-chat/internal/models"
 )
 
@@ -13,6 +14,11 @@ type WSMessageRequest struct {
 	ChannelID int    `json:"channel_id"`
 	Message   string `json:"message"`
 	IsPassive bool   `json:"is_passive"`
+	ReplyTo   int    `json:"reply_to,omitempty"`  // message whose thread to reply in
+	Broadcast bool   `json:"broadcast,omitempty"` // also show the reply in the channel
+
+	// IDs of uploaded attachments to send with the message
+	Attachments []int `json:"attachments,omitempty"`
 }
 
 func (h *WebSocketHandler) HandleMessage(sess *chat.Session, data []byte) error {
@@ -26,10 +32,14 @@ func (h *WebSocketHandler) HandleMessage(sess *chat.Session, data []byte) error
 		return sess.RespondError(req.ReqID, "Must be logged in to send messages", nil)
 	}
 
-	// Check if message is not empty
-	if req.Message == "" {
+	// Check if message is not empty, attachments alone are fine
+	req.Attachments = uniqueIDs(req.Attachments)
+	if req.Message == "" && len(req.Attachments) == 0 {
 		return sess.RespondError(req.ReqID, "Message cannot be empty", nil)
 	}
+	if len(req.Attachments) > models.MaxMessageAttachments {
+		return sess.RespondError(req.ReqID, fmt.Sprintf("A message can have at most %d attachments", models.MaxMessageAttachments), nil)
+	}
 
 	// Check if channel exists
 	channel, err := models.GetChannelByID(h.db, req.ChannelID)
@@ -45,8 +55,30 @@ func (h *WebSocketHandler) HandleMessage(sess *chat.Session, data []byte) error
 		return sess.RespondError(req.ReqID, "Not in channel", nil)
 	}
 
+	// Attachments can be sent once, by whoever uploaded them
+	unsent, err := models.CountUnsentAttachments(h.db, *sess.UserID, req.Attachments)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if unsent != len(req.Attachments) {
+		return sess.RespondError(req.ReqID, "Attachment not found", nil)
+	}
+
 	// Create message in database
-	dbMessage, err := models.CreateMessage(h.db, &req.ChannelID, *sess.UserID, req.Message, "message", *sess.Nickname, req.IsPassive)
+	var dbMessage *models.Message
+	if req.ReplyTo != 0 {
+		var parent *models.Message
+		parent, err = h.threadParent(req.ReplyTo)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		if parent == nil || *parent.ChannelID != req.ChannelID {
+			return sess.RespondError(req.ReqID, "Message to reply to not found", nil)
+		}
+		dbMessage, err = models.CreateReply(h.db, req.ChannelID, *sess.UserID, req.Message, *sess.Nickname, req.IsPassive, parent.ID, req.Broadcast)
+	} else {
+		dbMessage, err = models.CreateMessage(h.db, &req.ChannelID, *sess.UserID, req.Message, "message", *sess.Nickname, req.IsPassive)
+	}
 	if err != nil {
 		return sess.RespondError(req.ReqID, "Failed to send message", err)
 	}
@@ -54,16 +86,30 @@ func (h *WebSocketHandler) HandleMessage(sess *chat.Session, data []byte) error
 	// Broadcast message to all users in the channel
 	wsMessage := WSMessage{
 		Type:      "message",
+		ID:        dbMessage.ID,
 		ChannelID: req.ChannelID,
 		Message:   req.Message,
 		IsPassive: req.IsPassive,
 		SentAt:    dbMessage.SentAt.Format(time.RFC3339),
 		UserID:    *sess.UserID,
 		Nickname:  *sess.Nickname,
+		HTML:      dbMessage.HTML,
+		Plain:     dbMessage.Plain,
+	}
+	if len(req.Attachments) > 0 {
+		wsMessage.Attachments = h.attachToMessage(sess, req.Attachments, dbMessage)
+	}
+	if dbMessage.ReplyTo != nil {
+		wsMessage.ReplyTo = *dbMessage.ReplyTo
+		wsMessage.ReplyBroadcast = dbMessage.ReplyBroadcast
 	}
-	h.sessions.BroadcastToChannel(req.ChannelID, wsMessage)
+	h.typing.Stop(req.ChannelID, *sess.UserID)
+	h.sessions.BroadcastToChannel(req.ChannelID, wsMessage.echoedBy(sess, req.ReqID))
+	h.hooks.Dispatch(dbMessage)
+	h.unfurler.Unfurl(dbMessage)
+	h.notifyMentions(sess, dbMessage, channel)
 
-	log.Printf("Message sent by %s to channel %d: %s", *sess.Nickname, req.ChannelID, req.Message)
+	req.Logger(sess).Debug("Message sent", "nickname", *sess.Nickname, "channel_id", req.ChannelID, logging.Content(req.Message))
 
 	return sess.RespondSuccess(req.ReqID, nil)
 }
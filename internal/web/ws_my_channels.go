@@ -1,8 +1,6 @@
 package web
 
 import (
-	"log"
-
 	"throwback-chat/internal/chat"
 	"throwback-chat/internal/models"
 )
@@ -12,7 +10,13 @@ type WSMyChannelsRequest struct {
 }
 
 type WSMyChannelsResponse struct {
-	Channels []models.ChannelInfo `json:"channels"`
+	Channels []MyChannelInfo `json:"channels"`
+}
+
+// MyChannelInfo is a channel the user is in with their unread state
+type MyChannelInfo struct {
+	models.ChannelInfo
+	models.UnreadState
 }
 
 func (h *WebSocketHandler) HandleMyChannels(sess *chat.Session, data []byte) error {
@@ -28,17 +32,17 @@ func (h *WebSocketHandler) HandleMyChannels(sess *chat.Session, data []byte) err
 
 	// Get channels from current session state (not database reconstruction)
 	channelIDs := sess.GetChannels()
-	var channels []models.ChannelInfo
+	var channels []MyChannelInfo
 
 	for _, channelID := range channelIDs {
 		// Get channel metadata from database
 		channel, err := models.GetChannelByID(h.db, channelID)
 		if err != nil {
-			log.Printf("Failed to get channel %d metadata: %v", channelID, err)
+			req.Logger(sess).Error("Failed to get channel metadata", "channel_id", channelID, "error", err)
 			continue // Skip this channel if we can't get its metadata
 		}
 		if channel == nil {
-			log.Printf("Channel %d not found in database", channelID)
+			req.Logger(sess).Warn("Channel not found in database", "channel_id", channelID)
 			continue // Skip this channel if it doesn't exist
 		}
 
@@ -46,15 +50,18 @@ func (h *WebSocketHandler) HandleMyChannels(sess *chat.Session, data []byte) err
 		userCount := h.sessions.GetChannelUserCount(channelID)
 
 		// Build ChannelInfo
-		channels = append(channels, models.ChannelInfo{
-			ID:        channel.ID,
-			Name:      channel.Name,
-			Topic:     channel.Topic,
-			UserCount: userCount,
+		channels = append(channels, MyChannelInfo{
+			ChannelInfo: models.ChannelInfo{
+				ID:        channel.ID,
+				Name:      channel.Name,
+				Topic:     channel.Topic,
+				UserCount: userCount,
+			},
+			UnreadState: h.unreadState(sess, channelID),
 		})
 	}
 
-	log.Printf("User %s requested their channel list, returning %d channels from session state", *sess.Nickname, len(channels))
+	req.Logger(sess).Debug("Returning channel list from session state", "channels", len(channels))
 
 	return sess.RespondSuccess(req.ReqID, WSMyChannelsResponse{
 		Channels: channels,
@@ -1,7 +1,6 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
@@ -50,6 +49,13 @@ func (h *WebSocketHandler) HandleNick(sess *chat.Session, data []byte) error {
 		}
 	}
 
+	// Bot nicknames can only be used with the bot's token
+	if existing, err := models.GetUserByNickname(h.db, req.NewNickname); err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	} else if existing != nil && existing.IsBot && existing.ID != *sess.UserID {
+		return sess.RespondError(req.ReqID, "Nickname is reserved for a bot", nil)
+	}
+
 	// Update nickname in database
 	if err := models.UpdateUserNickname(h.db, *sess.UserID, req.NewNickname); err != nil {
 		return sess.RespondError(req.ReqID, "Database error", err)
@@ -63,10 +69,10 @@ func (h *WebSocketHandler) HandleNick(sess *chat.Session, data []byte) error {
 
 	// Create nick change events in database and broadcast to all channels user is in
 	for _, channelID := range userChannels {
-		// Create nick change event in database
-		_, err := models.CreateMessage(h.db, &channelID, *sess.UserID, "", "nick_change", req.NewNickname, false)
+		// Create nick change event in database, the old nickname is its content
+		dbMessage, err := models.CreateMessage(h.db, &channelID, *sess.UserID, oldNickname, "nick_change", req.NewNickname, false)
 		if err != nil {
-			log.Printf("Failed to create nick change message for channel %d: %v", channelID, err)
+			req.Logger(sess).Error("Failed to create nick change message", "channel_id", channelID, "error", err)
 			// Continue to other channels even if one fails
 			continue
 		}
@@ -74,16 +80,20 @@ func (h *WebSocketHandler) HandleNick(sess *chat.Session, data []byte) error {
 		// Broadcast nick change event to all users in the channel
 		nickChangeEvent := WSEvent{
 			Type:      "event",
+			ID:        dbMessage.ID,
 			ChannelID: channelID,
 			Event:     "nick_change",
 			UserID:    *sess.UserID,
 			Nickname:  req.NewNickname,
 			SentAt:    time.Now().Format(time.RFC3339),
+
+			OldNickname: oldNickname,
+			NewNickname: req.NewNickname,
 		}
 		h.sessions.BroadcastToChannel(channelID, nickChangeEvent)
 	}
 
-	log.Printf("User %s (ID: %d) changed nickname to %s on session %s", oldNickname, *sess.UserID, req.NewNickname, sess.ID)
+	req.Logger(sess).Info("User changed nickname", "old_nickname", oldNickname, "new_nickname", req.NewNickname)
 
 	return sess.RespondSuccess(req.ReqID, WSNickResponse{
 		UserID:      *sess.UserID,
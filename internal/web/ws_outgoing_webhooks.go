@@ -0,0 +1,250 @@
+package web
+
+import (
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/hooks"
+	"throwback-chat/internal/models"
+	"throwback-chat/internal/netguard"
+)
+
+type WSCreateOutgoingWebhookRequest struct {
+	WSRequest
+	ChannelID    int    `json:"channel_id"`
+	URL          string `json:"url"`
+	Event        string `json:"event"`
+	Prefix       string `json:"prefix,omitempty"`
+	Regex        string `json:"regex,omitempty"`
+	PostResponse bool   `json:"post_response"`
+	Nickname     string `json:"nickname,omitempty"`
+}
+
+type WSListOutgoingWebhooksRequest struct {
+	WSRequest
+	ChannelID int `json:"channel_id"`
+}
+
+type WSListOutgoingWebhooksResponse struct {
+	ChannelID int                      `json:"channel_id"`
+	Webhooks  []models.OutgoingWebhook `json:"webhooks"`
+}
+
+type WSRevokeOutgoingWebhookRequest struct {
+	WSRequest
+	WebhookID int `json:"webhook_id"`
+}
+
+type WSWebhookDeliveriesRequest struct {
+	WSRequest
+	WebhookID int `json:"webhook_id"`
+	Limit     int `json:"limit,omitempty"`
+}
+
+type WSWebhookDeliveriesResponse struct {
+	WebhookID  int                      `json:"webhook_id"`
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+func (h *WebSocketHandler) HandleCreateOutgoingWebhook(sess *chat.Session, data []byte) error {
+	var req WSCreateOutgoingWebhookRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to create webhooks", nil)
+	}
+
+	// Validate required fields
+	if req.ChannelID == 0 {
+		return sess.RespondError(req.ReqID, "Channel ID is required", nil)
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return sess.RespondError(req.ReqID, "Webhook URL must be an http or https URL", nil)
+	}
+	// Names are checked when delivering, addresses can be refused right away
+	if addr, err := netip.ParseAddr(target.Hostname()); err == nil && !netguard.Permitted(addr, h.webhookAllowedNets) {
+		return sess.RespondError(req.ReqID, "Webhook URL must point to a public address", nil)
+	}
+
+	if req.Event == "" {
+		req.Event = "message"
+	}
+	if !hooks.IsEvent(req.Event) {
+		return sess.RespondError(req.ReqID, "Unsupported event, must be one of "+strings.Join(hooks.Events, ", "), nil)
+	}
+
+	hook := &models.OutgoingWebhook{
+		ChannelID:       req.ChannelID,
+		URL:             req.URL,
+		Event:           req.Event,
+		PostResponse:    req.PostResponse,
+		CreatedByUserID: *sess.UserID,
+	}
+
+	// Prefix and regex only make sense for messages
+	switch {
+	case req.Prefix != "" && req.Regex != "":
+		return sess.RespondError(req.ReqID, "Only one of prefix and regex may be given", nil)
+	case (req.Prefix != "" || req.Regex != "") && req.Event != "message":
+		return sess.RespondError(req.ReqID, "Prefix and regex can only be used with message events", nil)
+	case req.Prefix != "":
+		hook.MatchType = models.MatchPrefix
+		hook.Pattern = req.Prefix
+	case req.Regex != "":
+		if _, err := regexp.Compile(req.Regex); err != nil {
+			return sess.RespondError(req.ReqID, "Invalid regex: "+err.Error(), nil)
+		}
+		hook.MatchType = models.MatchRegex
+		hook.Pattern = req.Regex
+	}
+
+	hook.Nickname = strings.TrimSpace(req.Nickname)
+	if ok, err := h.checkWebhookNickname(sess, req.ReqID, hook.Nickname); !ok {
+		return err
+	}
+
+	if ok, err := h.requireChannelOp(sess, req.ReqID, req.ChannelID, "create webhooks"); !ok {
+		return err
+	}
+
+	// Verify the channel exists
+	channel, err := models.GetChannelByID(h.db, req.ChannelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if channel == nil {
+		return sess.RespondError(req.ReqID, "Channel not found", nil)
+	}
+
+	hook, err = models.CreateOutgoingWebhook(h.db, hook)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Failed to create webhook", err)
+	}
+
+	req.Logger(sess).Info("User created outgoing webhook",
+		"nickname", *sess.Nickname, "channel", channel.Name, "channel_id", channel.ID,
+		"webhook_id", hook.ID, "event", hook.Event, "url", target.Redacted())
+
+	return sess.RespondSuccess(req.ReqID, hook)
+}
+
+func (h *WebSocketHandler) HandleListOutgoingWebhooks(sess *chat.Session, data []byte) error {
+	var req WSListOutgoingWebhooksRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to list webhooks", nil)
+	}
+
+	// Validate required fields
+	if req.ChannelID == 0 {
+		return sess.RespondError(req.ReqID, "Channel ID is required", nil)
+	}
+
+	// Webhook secrets are only for ops to see
+	if ok, err := h.requireChannelOp(sess, req.ReqID, req.ChannelID, "list webhooks"); !ok {
+		return err
+	}
+
+	webhooks, err := models.GetChannelOutgoingWebhooks(h.db, req.ChannelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSListOutgoingWebhooksResponse{
+		ChannelID: req.ChannelID,
+		Webhooks:  webhooks,
+	})
+}
+
+// outgoingWebhookForOp loads an outgoing webhook and checks that the session's
+// user operates its channel
+func (h *WebSocketHandler) outgoingWebhookForOp(sess *chat.Session, reqID string, webhookID int, action string) (*models.OutgoingWebhook, error) {
+	if webhookID == 0 {
+		return nil, sess.RespondError(reqID, "Webhook ID is required", nil)
+	}
+
+	hook, err := models.GetOutgoingWebhookByID(h.db, webhookID)
+	if err != nil {
+		return nil, sess.RespondError(reqID, "Database error", err)
+	}
+	if hook == nil {
+		return nil, sess.RespondError(reqID, "Webhook not found", nil)
+	}
+
+	if ok, err := h.requireChannelOp(sess, reqID, hook.ChannelID, action); !ok {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (h *WebSocketHandler) HandleRevokeOutgoingWebhook(sess *chat.Session, data []byte) error {
+	var req WSRevokeOutgoingWebhookRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to revoke webhooks", nil)
+	}
+
+	hook, err := h.outgoingWebhookForOp(sess, req.ReqID, req.WebhookID, "revoke webhooks")
+	if hook == nil {
+		return err
+	}
+
+	if err := models.DeleteOutgoingWebhook(h.db, hook.ID); err != nil {
+		return sess.RespondError(req.ReqID, "Failed to revoke webhook", err)
+	}
+
+	req.Logger(sess).Info("User revoked outgoing webhook",
+		"nickname", *sess.Nickname, "channel_id", hook.ChannelID, "webhook_id", hook.ID)
+
+	return sess.RespondSuccess(req.ReqID, WSRevokeWebhookResponse{
+		WebhookID: hook.ID,
+		ChannelID: hook.ChannelID,
+	})
+}
+
+func (h *WebSocketHandler) HandleWebhookDeliveries(sess *chat.Session, data []byte) error {
+	var req WSWebhookDeliveriesRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to view webhook deliveries", nil)
+	}
+
+	hook, err := h.outgoingWebhookForOp(sess, req.ReqID, req.WebhookID, "view webhook deliveries")
+	if hook == nil {
+		return err
+	}
+
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(h.db, hook.ID, req.Limit)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSWebhookDeliveriesResponse{
+		WebhookID:  hook.ID,
+		Deliveries: deliveries,
+	})
+}
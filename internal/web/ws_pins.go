@@ -0,0 +1,173 @@
+package web
+
+import (
+	"fmt"
+
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+type WSPinRequest struct {
+	WSRequest
+	MessageID int `json:"message_id"`
+}
+
+type WSPinsRequest struct {
+	WSRequest
+	ChannelID int `json:"channel_id"`
+}
+
+type WSPinsResponse struct {
+	ChannelID int           `json:"channel_id"`
+	Pins      []*models.Pin `json:"pins"`
+}
+
+// WSPinEvent tells the channel that a message was pinned or unpinned. Pin
+// is set when a message was pinned.
+type WSPinEvent struct {
+	Type      string      `json:"type"`
+	ChannelID int         `json:"channel_id"`
+	MessageID int         `json:"message_id"`
+	UserID    int         `json:"user_id"` // who pinned or unpinned it
+	Nickname  string      `json:"nickname"`
+	Action    string      `json:"action"` // add or remove
+	Pin       *models.Pin `json:"pin,omitempty"`
+}
+
+// ForSession skips sessions without pins and drops the renderings of the
+// pinned message for sessions without rendered-text
+func (e WSPinEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapPins) {
+		return nil
+	}
+	if e.Pin != nil && !s.HasCapability(chat.CapRendered) {
+		pin := *e.Pin
+		pin.HTML, pin.Plain = "", ""
+		e.Pin = &pin
+	}
+	return e
+}
+
+// pinsForSession drops the renderings of pins fetched for a session without
+// rendered-text
+func pinsForSession(s *chat.Session, pins []*models.Pin) []*models.Pin {
+	if !s.HasCapability(chat.CapRendered) {
+		for _, pin := range pins {
+			pin.HTML, pin.Plain = "", ""
+		}
+	}
+	return pins
+}
+
+func (h *WebSocketHandler) HandlePin(sess *chat.Session, data []byte) error {
+	return h.handlePin(sess, data, true)
+}
+
+func (h *WebSocketHandler) HandleUnpin(sess *chat.Session, data []byte) error {
+	return h.handlePin(sess, data, false)
+}
+
+// handlePin pins or unpins a chat message for the operators of its channel.
+// Repeating either is not an error.
+func (h *WebSocketHandler) handlePin(sess *chat.Session, data []byte, pin bool) error {
+	var req WSPinRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to pin messages", nil)
+	}
+
+	message, err := models.GetMessageByID(h.db, req.MessageID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if message == nil || message.ChannelID == nil || message.Event != "message" {
+		return sess.RespondError(req.ReqID, "Message not found", nil)
+	}
+	channelID := *message.ChannelID
+
+	// Check if the requesting user is an operator of the channel
+	isOp, err := models.IsUserOp(h.db, *sess.UserID, channelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if !isOp {
+		return sess.RespondError(req.ReqID, "You must be an operator to pin messages", nil)
+	}
+
+	var changed bool
+	event := WSPinEvent{
+		Type:      "pin",
+		ChannelID: channelID,
+		MessageID: message.ID,
+		UserID:    *sess.UserID,
+		Nickname:  *sess.Nickname,
+		Action:    "add",
+	}
+	if pin {
+		count, err := models.CountPins(h.db, channelID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		pinned, err := models.GetPin(h.db, channelID, message.ID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		if pinned == nil && count >= models.MaxPins {
+			return sess.RespondError(req.ReqID, fmt.Sprintf("A channel can have at most %d pinned messages", models.MaxPins), nil)
+		}
+
+		changed, err = models.PinMessage(h.db, channelID, message.ID, *sess.UserID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Failed to pin message", err)
+		}
+		event.Pin, err = models.GetPin(h.db, channelID, message.ID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+	} else {
+		event.Action = "remove"
+		changed, err = models.UnpinMessage(h.db, channelID, message.ID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Failed to unpin message", err)
+		}
+	}
+
+	if changed {
+		h.sessions.BroadcastToChannel(channelID, event)
+		req.Logger(sess).Info("User changed pinned messages",
+			"nickname", *sess.Nickname, "channel_id", channelID, "message_id", message.ID, "action", event.Action)
+	}
+
+	return sess.RespondSuccess(req.ReqID, nil)
+}
+
+// HandlePins lists the pinned messages of a channel the user is in
+func (h *WebSocketHandler) HandlePins(sess *chat.Session, data []byte) error {
+	var req WSPinsRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to list pinned messages", nil)
+	}
+
+	if !sess.IsInChannel(req.ChannelID) {
+		return sess.RespondError(req.ReqID, "Not in channel", nil)
+	}
+
+	pins, err := models.GetPins(h.db, req.ChannelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Failed to retrieve pinned messages", err)
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSPinsResponse{
+		ChannelID: req.ChannelID,
+		Pins:      pinsForSession(sess, pins),
+	})
+}
@@ -1,7 +1,6 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
@@ -9,8 +8,7 @@ import (
 )
 
 type QuitRequest struct {
-	Cmd          string  `json:"cmd"`
-	ReqID        string  `json:"req_id"`
+	WSRequest
 	DyingMessage *string `json:"dying_message,omitempty"`
 }
 
@@ -38,20 +36,23 @@ func (h *WebSocketHandler) HandleQuit(sess *chat.Session, data []byte) error {
 	// Send leave events to all channels
 	for _, channelID := range userChannels {
 		// Create database record
-		_, err := models.CreateMessage(h.db, &channelID, userID, dyingMessage, "left", nickname, false)
+		leaveMessage, err := models.CreateMessage(h.db, &channelID, userID, dyingMessage, "left", nickname, false)
 		if err != nil {
 			// Log error but continue with other channels
-			log.Printf("Failed to create leave message for channel %d: %v", channelID, err)
+			req.Logger(sess).Error("Failed to create leave message", "channel_id", channelID, "error", err)
 		}
+		h.hooks.Dispatch(leaveMessage)
 
 		// Broadcast leave event to other users in the channel
 		leaveEvent := WSEvent{
 			Type:      "event",
+			ID:        messageID(leaveMessage),
 			ChannelID: channelID,
 			Event:     "left",
 			UserID:    userID,
 			Nickname:  nickname,
 			SentAt:    time.Now().UTC().Format(time.RFC3339),
+			Reason:    dyingMessage,
 		}
 
 		h.sessions.BroadcastToChannel(channelID, leaveEvent)
@@ -62,7 +63,7 @@ func (h *WebSocketHandler) HandleQuit(sess *chat.Session, data []byte) error {
 
 	// Send success response
 	if err := sess.RespondSuccess(req.ReqID, QuitResponse{Message: "Goodbye!"}); err != nil {
-		log.Printf("Failed to send quit response: %v", err)
+		req.Logger(sess).Warn("Failed to send quit response", "error", err)
 	}
 
 	// Return a termination error to close the WebSocket connection
@@ -0,0 +1,326 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+// RawCommand describes one slash command understood by the raw command. It
+// mirrors the grammar of the web client in web/src/utils/commands.ts.
+type RawCommand struct {
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	Usage           string   `json:"usage"`
+	MinArgs         int      `json:"min_args"`
+	MaxArgs         int      `json:"max_args"` // -1 means unlimited
+	Aliases         []string `json:"aliases,omitempty"`
+	RequiresChannel bool     `json:"requires_channel"`
+	RequiresOp      bool     `json:"requires_op"`
+}
+
+var rawCommands = map[string]RawCommand{
+	"join": {
+		Name:        "join",
+		Description: "Join a channel",
+		Usage:       "/join channel",
+		MinArgs:     1,
+		MaxArgs:     1,
+	},
+	"leave": {
+		Name:            "leave",
+		Description:     "Leave current channel with optional reason",
+		Usage:           "/leave [reason]",
+		MinArgs:         0,
+		MaxArgs:         -1,
+		Aliases:         []string{"part"},
+		RequiresChannel: true,
+	},
+	"nick": {
+		Name:        "nick",
+		Description: "Change your nickname",
+		Usage:       "/nick newname",
+		MinArgs:     1,
+		MaxArgs:     1,
+	},
+	"me": {
+		Name:            "me",
+		Description:     "Send an action message",
+		Usage:           "/me does something",
+		MinArgs:         1,
+		MaxArgs:         -1,
+		RequiresChannel: true,
+	},
+	"kick": {
+		Name:            "kick",
+		Description:     "Kick a user from the channel",
+		Usage:           "/kick username [reason]",
+		MinArgs:         1,
+		MaxArgs:         -1,
+		RequiresChannel: true,
+		RequiresOp:      true,
+	},
+	"topic": {
+		Name:            "topic",
+		Description:     "Change the channel topic",
+		Usage:           "/topic new topic text",
+		MinArgs:         1,
+		MaxArgs:         -1,
+		RequiresChannel: true,
+	},
+	"announce": {
+		Name:            "announce",
+		Description:     "Make an announcement in the channel (requires op)",
+		Usage:           "/announce announcement text",
+		MinArgs:         1,
+		MaxArgs:         -1,
+		RequiresChannel: true,
+		RequiresOp:      true,
+	},
+	"help": {
+		Name:        "help",
+		Description: "Show available commands",
+		Usage:       "/help [command]",
+		MinArgs:     0,
+		MaxArgs:     1,
+	},
+}
+
+// rawCommandAliases maps alternative names to their command
+var rawCommandAliases = map[string]string{
+	"part": "leave",
+}
+
+type WSRawRequest struct {
+	WSRequest
+	Line      string `json:"line"`
+	ChannelID int    `json:"channel_id,omitempty"`
+}
+
+type WSCommandsRequest struct {
+	WSRequest
+	Command string `json:"command,omitempty"`
+}
+
+type WSCommandsResponse struct {
+	Commands []RawCommand `json:"commands"`
+}
+
+// parsedLine is a slash command split into its name and arguments. RawArgs
+// is the line after the command name as it was typed.
+type parsedLine struct {
+	Command RawCommand
+	Args    []string
+	RawArgs string
+}
+
+// argsFrom returns the text of the arguments from the i-th on as it was
+// typed, whitespace and all
+func (p *parsedLine) argsFrom(i int) string {
+	return skipFields(p.RawArgs, i)
+}
+
+// skipFields drops the first n whitespace separated fields of s and the
+// whitespace around them
+func skipFields(s string, n int) string {
+	for ; n > 0; n-- {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		s = s[end:]
+	}
+	return strings.TrimLeftFunc(s, unicode.IsSpace)
+}
+
+// lookupRawCommand finds a command by name or alias
+func lookupRawCommand(name string) (RawCommand, bool) {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	if target, ok := rawCommandAliases[name]; ok {
+		name = target
+	}
+	command, ok := rawCommands[name]
+	return command, ok
+}
+
+// parseRawLine parses a line starting with a slash. The returned error is
+// meant to be shown to the user.
+func parseRawLine(line string) (*parsedLine, error) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "/")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, errors.New("Missing command. Type /help for available commands.")
+	}
+
+	command, ok := lookupRawCommand(fields[0])
+	if !ok {
+		return nil, fmt.Errorf("Unknown command: /%s. Type /help for available commands.", strings.ToLower(fields[0]))
+	}
+
+	args := fields[1:]
+	if len(args) < command.MinArgs {
+		return nil, fmt.Errorf("Too few arguments. Usage: %s", command.Usage)
+	}
+	if command.MaxArgs != -1 && len(args) > command.MaxArgs {
+		return nil, fmt.Errorf("Too many arguments. Usage: %s", command.Usage)
+	}
+
+	return &parsedLine{
+		Command: command,
+		Args:    args,
+		RawArgs: skipFields(line, 1),
+	}, nil
+}
+
+// sortedRawCommands returns the grammar in a stable order
+func sortedRawCommands() []RawCommand {
+	commands := make([]RawCommand, 0, len(rawCommands))
+	for _, command := range rawCommands {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+func (h *WebSocketHandler) HandleCommands(sess *chat.Session, data []byte) error {
+	var req WSCommandsRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	if req.Command == "" {
+		return sess.RespondSuccess(req.ReqID, WSCommandsResponse{Commands: sortedRawCommands()})
+	}
+
+	command, ok := lookupRawCommand(req.Command)
+	if !ok {
+		return sess.RespondError(req.ReqID, "Unknown command: /"+req.Command, nil)
+	}
+	return sess.RespondSuccess(req.ReqID, WSCommandsResponse{Commands: []RawCommand{command}})
+}
+
+// HandleRaw parses an IRC style line and runs the command it stands for. The
+// response is the one of the command that was run, so a /kick is answered
+// like a kick. Lines without a leading slash are sent as messages.
+func (h *WebSocketHandler) HandleRaw(sess *chat.Session, data []byte) error {
+	var req WSRawRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to send commands", nil)
+	}
+
+	line := strings.TrimSpace(req.Line)
+	if line == "" {
+		return sess.RespondError(req.ReqID, "Line is required", nil)
+	}
+
+	// A doubled slash escapes a message that starts with one
+	if !strings.HasPrefix(line, "/") || strings.HasPrefix(line, "//") {
+		if req.ChannelID == 0 {
+			return sess.RespondError(req.ReqID, "Channel ID is required", nil)
+		}
+		message := req.Line
+		if strings.HasPrefix(line, "//") {
+			message = line[1:]
+		}
+		return h.dispatchRaw(sess, req.ReqID, "message", WSMessageRequest{
+			ChannelID: req.ChannelID,
+			Message:   message,
+		})
+	}
+
+	parsed, err := parseRawLine(line)
+	if err != nil {
+		return sess.RespondError(req.ReqID, err.Error(), nil)
+	}
+	if parsed.Command.RequiresChannel && req.ChannelID == 0 {
+		return sess.RespondError(req.ReqID, "This command requires you to be in a channel.", nil)
+	}
+
+	switch parsed.Command.Name {
+	case "join":
+		return h.dispatchRaw(sess, req.ReqID, "join", WSJoinRequest{ChannelName: parsed.Args[0]})
+	case "leave":
+		return h.dispatchRaw(sess, req.ReqID, "leave", WSLeaveRequest{ChannelID: req.ChannelID, Reason: parsed.RawArgs})
+	case "nick":
+		return h.dispatchRaw(sess, req.ReqID, "nick", WSNickRequest{NewNickname: parsed.Args[0]})
+	case "me":
+		return h.dispatchRaw(sess, req.ReqID, "me", WSMeRequest{ChannelID: req.ChannelID, Message: parsed.RawArgs})
+	case "kick":
+		userID, err := h.resolveChannelNickname(req.ChannelID, parsed.Args[0])
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		if userID == 0 {
+			return sess.RespondError(req.ReqID, fmt.Sprintf("User %q not found in this channel", parsed.Args[0]), nil)
+		}
+		return h.dispatchRaw(sess, req.ReqID, "kick", WSKickRequest{
+			UserID:    userID,
+			ChannelID: req.ChannelID,
+			Reason:    parsed.argsFrom(1),
+		})
+	case "topic":
+		return h.dispatchRaw(sess, req.ReqID, "topic", WSTopicRequest{ChannelID: req.ChannelID, Topic: parsed.RawArgs})
+	case "announce":
+		channelID := req.ChannelID
+		return h.dispatchRaw(sess, req.ReqID, "announce", WSAnnounceRequest{ChannelID: &channelID, Message: parsed.RawArgs})
+	case "help":
+		request := WSCommandsRequest{}
+		if len(parsed.Args) > 0 {
+			request.Command = parsed.Args[0]
+		}
+		return h.dispatchRaw(sess, req.ReqID, "commands", request)
+	default:
+		return sess.RespondError(req.ReqID, "Unknown command: /"+parsed.Command.Name, nil)
+	}
+}
+
+// resolveChannelNickname returns the ID of the channel member with the given
+// nickname, or 0 if there is none
+func (h *WebSocketHandler) resolveChannelNickname(channelID int, nickname string) (int, error) {
+	users, err := models.GetChannelUsers(h.db, channelID)
+	if err != nil {
+		return 0, err
+	}
+	for _, user := range users {
+		if strings.EqualFold(user.Nickname, nickname) {
+			return user.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// dispatchRaw runs a command built from a raw line as if the client had sent
+// it, under the raw request's req_id. Bot restrictions apply to the command
+// that ends up running.
+func (h *WebSocketHandler) dispatchRaw(sess *chat.Session, reqID, cmd string, request any) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return sess.RespondError(reqID, "Failed to build command", err)
+	}
+
+	// Fill in the envelope without caring how the request embeds it
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return sess.RespondError(reqID, "Failed to build command", err)
+	}
+	fields["type"] = "request"
+	fields["cmd"] = cmd
+	fields["req_id"] = reqID
+	if data, err = json.Marshal(fields); err != nil {
+		return sess.RespondError(reqID, "Failed to build command", err)
+	}
+
+	return h.dispatchCommand(sess, &WSRequest{Type: "request", Cmd: cmd, ReqID: reqID}, data)
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+const (
+	// maxReactionLength bounds an emoji, long enough for ZWJ sequences and
+	// :shortcodes:
+	maxReactionLength = 64
+
+	// maxReactionEmoji is how many different emoji one message can collect
+	maxReactionEmoji = 20
+)
+
+type WSReactRequest struct {
+	WSRequest
+	MessageID int    `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type WSReactResponse struct {
+	MessageID int    `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+}
+
+// WSReactionEvent tells the channel that a reaction was added or removed.
+// Count is the number of users reacting with the emoji afterwards.
+type WSReactionEvent struct {
+	Type      string `json:"type"`
+	ChannelID int    `json:"channel_id"`
+	MessageID int    `json:"message_id"`
+	UserID    int    `json:"user_id"`
+	Nickname  string `json:"nickname"`
+	Emoji     string `json:"emoji"`
+	Action    string `json:"action"` // add or remove
+	Count     int    `json:"count"`
+}
+
+// ForSession skips sessions without reactions
+func (e WSReactionEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapReactions) {
+		return nil
+	}
+	return e
+}
+
+func (h *WebSocketHandler) HandleReact(sess *chat.Session, data []byte) error {
+	return h.handleReaction(sess, data, true)
+}
+
+func (h *WebSocketHandler) HandleUnreact(sess *chat.Session, data []byte) error {
+	return h.handleReaction(sess, data, false)
+}
+
+// handleReaction adds or removes the user's reaction to a chat message in a
+// channel they are in. Repeating either is not an error.
+func (h *WebSocketHandler) handleReaction(sess *chat.Session, data []byte, add bool) error {
+	var req WSReactRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to react", nil)
+	}
+
+	if problem := invalidReaction(req.Emoji); problem != "" {
+		return sess.RespondError(req.ReqID, problem, nil)
+	}
+
+	message, err := models.GetMessageByID(h.db, req.MessageID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if message == nil || message.ChannelID == nil || message.Event != "message" {
+		return sess.RespondError(req.ReqID, "Message not found", nil)
+	}
+	channelID := *message.ChannelID
+
+	if !sess.IsInChannel(channelID) {
+		return sess.RespondError(req.ReqID, "Not in channel", nil)
+	}
+
+	var changed bool
+	action := "add"
+	if add {
+		emojiCount, err := models.CountReactionEmoji(h.db, message.ID)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		count, err := models.CountReactions(h.db, message.ID, req.Emoji)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Database error", err)
+		}
+		if count == 0 && emojiCount >= maxReactionEmoji {
+			return sess.RespondError(req.ReqID, fmt.Sprintf("A message can have at most %d different reactions", maxReactionEmoji), nil)
+		}
+
+		changed, err = models.AddReaction(h.db, message.ID, channelID, *sess.UserID, req.Emoji)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Failed to add reaction", err)
+		}
+	} else {
+		action = "remove"
+		changed, err = models.RemoveReaction(h.db, message.ID, *sess.UserID, req.Emoji)
+		if err != nil {
+			return sess.RespondError(req.ReqID, "Failed to remove reaction", err)
+		}
+	}
+
+	count, err := models.CountReactions(h.db, message.ID, req.Emoji)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+
+	if changed {
+		h.sessions.BroadcastToChannel(channelID, WSReactionEvent{
+			Type:      "reaction",
+			ChannelID: channelID,
+			MessageID: message.ID,
+			UserID:    *sess.UserID,
+			Nickname:  *sess.Nickname,
+			Emoji:     req.Emoji,
+			Action:    action,
+			Count:     count,
+		})
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSReactResponse{
+		MessageID: message.ID,
+		Emoji:     req.Emoji,
+		Count:     count,
+	})
+}
+
+// invalidReaction explains what is wrong with an emoji, or returns nothing
+// if it is fine. Any short text without whitespace is, so clients can use
+// Unicode emoji as well as :shortcodes:.
+func invalidReaction(emoji string) string {
+	switch {
+	case emoji == "":
+		return "Emoji is required"
+	case len(emoji) > maxReactionLength:
+		return fmt.Sprintf("Emoji cannot exceed %d bytes", maxReactionLength)
+	case strings.IndexFunc(emoji, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		return "Emoji cannot contain whitespace"
+	}
+	return ""
+}
@@ -1,15 +1,14 @@
 package web
 
 import (
-	"log"
+	"log/slog"
 
 	"throwback-chat/internal/chat"
 	"throwback-chat/internal/models"
 )
 
 type SessionInfoRequest struct {
-	Cmd   string `json:"cmd"`
-	ReqID string `json:"req_id"`
+	WSRequest
 }
 
 func (h *WebSocketHandler) HandleSessionInfo(sess *chat.Session, data []byte) error {
@@ -32,9 +31,10 @@ func (h *WebSocketHandler) HandleSessionInfo(sess *chat.Session, data []byte) er
 		// Get channel info from database
 		if channel := h.getChannelInfo(channelID); channel != nil {
 			channels = append(channels, ChannelInfo{
-				ID:    channelID,
-				Name:  channel.Name,
-				Topic: channel.Topic,
+				ID:          channelID,
+				Name:        channel.Name,
+				Topic:       channel.Topic,
+				UnreadState: h.unreadState(sess, channelID),
 			})
 		}
 	}
@@ -53,11 +53,11 @@ func (h *WebSocketHandler) HandleSessionInfo(sess *chat.Session, data []byte) er
 func (h *WebSocketHandler) getChannelInfo(channelID int) *models.Channel {
 	channel, err := models.GetChannelByID(h.db, channelID)
 	if err != nil {
-		log.Printf("Failed to get channel info for ID %d: %v", channelID, err)
+		slog.Error("Failed to get channel info", "channel_id", channelID, "error", err)
 		return nil
 	}
 	if channel == nil {
-		log.Printf("Channel with ID %d not found", channelID)
+		slog.Warn("Channel not found", "channel_id", channelID)
 		return nil
 	}
 
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+type WSGetThreadRequest struct {
+	WSRequest
+	MessageID int  `json:"message_id"`
+	Limit     int  `json:"limit,omitempty"`
+	After     *int `json:"after,omitempty"` // reply ID to continue after
+}
+
+type WSThreadResponse struct {
+	Parent  interface{}   `json:"parent"`
+	Replies []interface{} `json:"replies"`
+	HasMore bool          `json:"has_more"`
+}
+
+// threadParent returns the message a reply to messageID belongs under, or
+// nil if it can't be replied to. Threads don't nest, replying to a reply
+// continues the thread it is in.
+func (h *WebSocketHandler) threadParent(messageID int) (*models.Message, error) {
+	message, err := models.GetMessageByID(h.db, messageID)
+	if err != nil || message == nil {
+		return nil, err
+	}
+	if message.ReplyTo != nil {
+		message, err = models.GetMessageByID(h.db, *message.ReplyTo)
+		if err != nil || message == nil {
+			return nil, err
+		}
+	}
+	if message.ChannelID == nil || message.Event != "message" {
+		return nil, nil
+	}
+	return message, nil
+}
+
+// HandleGetThread pages through the replies to a message, oldest first. Any
+// message of the thread can be given, the thread's first message is returned
+// as parent. Clients need threads to understand the replies.
+func (h *WebSocketHandler) HandleGetThread(sess *chat.Session, data []byte) error {
+	var req WSGetThreadRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to read threads", nil)
+	}
+
+	if !sess.HasCapability(chat.CapThreads) {
+		return sess.RespondError(req.ReqID, "The threads capability must be enabled to read threads", nil)
+	}
+
+	parent, err := h.threadParent(req.MessageID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if parent == nil || !sess.IsInChannel(*parent.ChannelID) {
+		return sess.RespondError(req.ReqID, "Message not found", nil)
+	}
+
+	if req.Limit <= 0 || req.Limit > models.MaxHistoryLimit {
+		req.Limit = 100
+	}
+
+	// Fetch one extra reply to find out whether there is another page
+	replies, err := models.GetThreadReplies(h.db, parent.ID, models.ThreadOptions{
+		Limit: req.Limit + 1,
+		After: req.After,
+	})
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Failed to retrieve thread", err)
+	}
+
+	response := WSThreadResponse{Replies: []interface{}{}}
+	if len(replies) > req.Limit {
+		replies = replies[:req.Limit]
+		response.HasMore = true
+	}
+
+	page := h.newHistoryPage(sess, *parent.ChannelID, append([]*models.Message{parent}, replies...))
+	response.Parent = page.payload(parent).ForSession(sess)
+	for _, reply := range replies {
+		response.Replies = append(response.Replies, page.payload(reply).ForSession(sess))
+	}
+
+	return sess.RespondSuccess(req.ReqID, response)
+}
@@ -1,13 +1,17 @@
 package web
 
 import (
-	"log"
 	"time"
 
 	"throwback-chat/internal/chat"
+	"throwback-chat/internal/logging"
 	"throwback-chat/internal/models"
 )
 
+// topicClearedMessage is stored as the content of topic_change events that
+// clear the topic
+const topicClearedMessage = "Topic cleared"
+
 type WSTopicRequest struct {
 	WSRequest
 	ChannelID int    `json:"channel_id"`
@@ -62,18 +66,20 @@ func (h *WebSocketHandler) HandleTopic(sess *chat.Session, data []byte) error {
 	// Create topic change event message
 	topicMessage := req.Topic
 	if topicMessage == "" {
-		topicMessage = "Topic cleared"
+		topicMessage = topicClearedMessage
 	}
 
 	// Create topic change event in database
-	_, err = models.CreateMessage(h.db, &req.ChannelID, *sess.UserID, topicMessage, "topic_change", *sess.Nickname, false)
+	dbMessage, err := models.CreateMessage(h.db, &req.ChannelID, *sess.UserID, topicMessage, "topic_change", *sess.Nickname, false)
 	if err != nil {
-		log.Printf("Failed to create topic change message: %v", err)
+		req.Logger(sess).Error("Failed to create topic change message", "channel_id", req.ChannelID, "error", err)
 	}
+	h.hooks.Dispatch(dbMessage)
 
 	// Broadcast topic change event to all users in the channel
 	topicEvent := WSEvent{
 		Type:      "event",
+		ID:        messageID(dbMessage),
 		ChannelID: req.ChannelID,
 		Event:     "topic_change",
 		UserID:    *sess.UserID,
@@ -83,8 +89,8 @@ func (h *WebSocketHandler) HandleTopic(sess *chat.Session, data []byte) error {
 	}
 	h.sessions.BroadcastToChannel(req.ChannelID, topicEvent)
 
-	log.Printf("User %s changed topic for channel %s (ID: %d) to: %s",
-		*sess.Nickname, channel.Name, channel.ID, req.Topic)
+	req.Logger(sess).Info("User changed channel topic",
+		"nickname", *sess.Nickname, "channel", channel.Name, "channel_id", channel.ID, logging.Content(req.Topic))
 
 	return sess.RespondSuccess(req.ReqID, WSTopicResponse{
 		ChannelID: req.ChannelID,
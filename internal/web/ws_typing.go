@@ -0,0 +1,84 @@
+package web
+
+import (
+	"throwback-chat/internal/chat"
+)
+
+// Typing states of the typing command and event
+const (
+	typingStart = "start"
+	typingStop  = "stop"
+)
+
+type WSTypingRequest struct {
+	WSRequest
+	ChannelID int    `json:"channel_id"`
+	State     string `json:"state"` // start or stop
+}
+
+// WSTypingEvent tells members that someone started or stopped typing. It is
+// never stored and only sent to sessions with the typing capability.
+type WSTypingEvent struct {
+	Type      string `json:"type"`
+	ChannelID int    `json:"channel_id"`
+	UserID    int    `json:"user_id"`
+	Nickname  string `json:"nickname"`
+	State     string `json:"state"`
+}
+
+// ForSession skips sessions without typing and the typist's own sessions
+func (e WSTypingEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapTyping) {
+		return nil
+	}
+	if s.UserID != nil && *s.UserID == e.UserID {
+		return nil
+	}
+	return e
+}
+
+// HandleTyping relays typing notices. Clients repeat start every few seconds
+// while the user types, a user who stops sending it stops typing after
+// chat.TypingTimeout, as does one who sends a message.
+func (h *WebSocketHandler) HandleTyping(sess *chat.Session, data []byte) error {
+	var req WSTypingRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to send typing notices", nil)
+	}
+
+	if !sess.IsInChannel(req.ChannelID) {
+		return sess.RespondError(req.ReqID, "Not in channel", nil)
+	}
+
+	switch req.State {
+	case typingStart:
+		h.typing.Start(req.ChannelID, *sess.UserID, *sess.Nickname)
+	case typingStop:
+		h.typing.Stop(req.ChannelID, *sess.UserID)
+	default:
+		return sess.RespondError(req.ReqID, "State must be start or stop", nil)
+	}
+
+	return sess.RespondSuccess(req.ReqID, nil)
+}
+
+// broadcastTyping passes typing updates on to the channel
+func (h *WebSocketHandler) broadcastTyping(update chat.TypingUpdate) {
+	state := typingStop
+	if update.Typing {
+		state = typingStart
+	}
+
+	h.sessions.BroadcastToChannel(update.ChannelID, WSTypingEvent{
+		Type:      "typing",
+		ChannelID: update.ChannelID,
+		UserID:    update.UserID,
+		Nickname:  update.Nickname,
+		State:     state,
+	})
+}
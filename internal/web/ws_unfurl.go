@@ -0,0 +1,33 @@
+package web
+
+import (
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+// WSUnfurlEvent attaches the previews of the links in a message to it once
+// they were fetched. Messages carry them in history and playback.
+type WSUnfurlEvent struct {
+	Type      string               `json:"type"`
+	ChannelID int                  `json:"channel_id"`
+	MessageID int                  `json:"message_id"`
+	Previews  []models.LinkPreview `json:"previews"`
+}
+
+// ForSession skips sessions without link-previews
+func (e WSUnfurlEvent) ForSession(s *chat.Session) interface{} {
+	if !s.HasCapability(chat.CapPreviews) {
+		return nil
+	}
+	return e
+}
+
+// broadcastUnfurl passes the previews of a message on to its channel
+func (h *WebSocketHandler) broadcastUnfurl(msg *models.Message, previews []models.LinkPreview) {
+	h.sessions.BroadcastToChannel(*msg.ChannelID, WSUnfurlEvent{
+		Type:      "message_unfurled",
+		ChannelID: *msg.ChannelID,
+		MessageID: msg.ID,
+		Previews:  previews,
+	})
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"strings"
+
+	"throwback-chat/internal/chat"
+	"throwback-chat/internal/models"
+)
+
+// maxWebhookNicknameLength limits the nickname a webhook posts under
+const maxWebhookNicknameLength = 32
+
+type WSCreateWebhookRequest struct {
+	WSRequest
+	ChannelID int    `json:"channel_id"`
+	Nickname  string `json:"nickname,omitempty"`
+}
+
+type WSCreateWebhookResponse struct {
+	Webhook *models.Webhook `json:"webhook"`
+	URL     string          `json:"url"`
+}
+
+type WSListWebhooksRequest struct {
+	WSRequest
+	ChannelID int `json:"channel_id"`
+}
+
+type WSListWebhooksResponse struct {
+	ChannelID int              `json:"channel_id"`
+	Webhooks  []models.Webhook `json:"webhooks"`
+}
+
+type WSRevokeWebhookRequest struct {
+	WSRequest
+	WebhookID int `json:"webhook_id"`
+}
+
+type WSRevokeWebhookResponse struct {
+	WebhookID int `json:"webhook_id"`
+	ChannelID int `json:"channel_id"`
+}
+
+// webhookPath returns the path a webhook accepts posts on
+func webhookPath(token string) string {
+	return "/api/hooks/" + token
+}
+
+// requireChannelOp checks that the session's user operates the channel. It
+// responds with an error and returns false otherwise.
+func (h *WebSocketHandler) requireChannelOp(sess *chat.Session, reqID string, channelID int, action string) (bool, error) {
+	isOp, err := models.IsUserOp(h.db, *sess.UserID, channelID)
+	if err != nil {
+		return false, sess.RespondError(reqID, "Database error", err)
+	}
+	if !isOp {
+		return false, sess.RespondError(reqID, "You must be an operator to "+action, nil)
+	}
+	return true, nil
+}
+
+// checkWebhookNickname checks the nickname a webhook posts under. Webhooks
+// post as the service user, so they may not take the nickname of any user.
+// It responds with an error and returns false for nicknames that can't be
+// used.
+func (h *WebSocketHandler) checkWebhookNickname(sess *chat.Session, reqID string, nickname string) (bool, error) {
+	if len(nickname) > maxWebhookNicknameLength || strings.ContainsAny(nickname, " \t\r\n") {
+		return false, sess.RespondError(reqID, "Invalid webhook nickname", nil)
+	}
+	if nickname == "" {
+		return true, nil
+	}
+	taken, err := models.NicknameTaken(h.db, nickname)
+	if err != nil {
+		return false, sess.RespondError(reqID, "Database error", err)
+	}
+	if taken {
+		return false, sess.RespondError(reqID, "Webhook nickname belongs to a user", nil)
+	}
+	return true, nil
+}
+
+func (h *WebSocketHandler) HandleCreateWebhook(sess *chat.Session, data []byte) error {
+	var req WSCreateWebhookRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to create webhooks", nil)
+	}
+
+	// Validate required fields
+	if req.ChannelID == 0 {
+		return sess.RespondError(req.ReqID, "Channel ID is required", nil)
+	}
+
+	nickname := strings.TrimSpace(req.Nickname)
+	if ok, err := h.checkWebhookNickname(sess, req.ReqID, nickname); !ok {
+		return err
+	}
+
+	if ok, err := h.requireChannelOp(sess, req.ReqID, req.ChannelID, "create webhooks"); !ok {
+		return err
+	}
+
+	// Verify the channel exists
+	channel, err := models.GetChannelByID(h.db, req.ChannelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if channel == nil {
+		return sess.RespondError(req.ReqID, "Channel not found", nil)
+	}
+
+	webhook, err := models.CreateWebhook(h.db, channel.ID, *sess.UserID, nickname)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Failed to create webhook", err)
+	}
+
+	req.Logger(sess).Info("User created webhook",
+		"nickname", *sess.Nickname, "channel", channel.Name, "channel_id", channel.ID, "webhook_id", webhook.ID)
+
+	return sess.RespondSuccess(req.ReqID, WSCreateWebhookResponse{
+		Webhook: webhook,
+		URL:     webhookPath(webhook.Token),
+	})
+}
+
+func (h *WebSocketHandler) HandleListWebhooks(sess *chat.Session, data []byte) error {
+	var req WSListWebhooksRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to list webhooks", nil)
+	}
+
+	// Validate required fields
+	if req.ChannelID == 0 {
+		return sess.RespondError(req.ReqID, "Channel ID is required", nil)
+	}
+
+	// Webhook tokens are secrets, so only ops get to see them
+	if ok, err := h.requireChannelOp(sess, req.ReqID, req.ChannelID, "list webhooks"); !ok {
+		return err
+	}
+
+	webhooks, err := models.GetChannelWebhooks(h.db, req.ChannelID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+
+	return sess.RespondSuccess(req.ReqID, WSListWebhooksResponse{
+		ChannelID: req.ChannelID,
+		Webhooks:  webhooks,
+	})
+}
+
+func (h *WebSocketHandler) HandleRevokeWebhook(sess *chat.Session, data []byte) error {
+	var req WSRevokeWebhookRequest
+	if err := DecodeWSData(sess, data, "", &req); err != nil {
+		return err
+	}
+
+	// Check if user is logged in
+	if sess.UserID == nil {
+		return sess.RespondError(req.ReqID, "Must be logged in to revoke webhooks", nil)
+	}
+
+	// Validate required fields
+	if req.WebhookID == 0 {
+		return sess.RespondError(req.ReqID, "Webhook ID is required", nil)
+	}
+
+	webhook, err := models.GetWebhookByID(h.db, req.WebhookID)
+	if err != nil {
+		return sess.RespondError(req.ReqID, "Database error", err)
+	}
+	if webhook == nil {
+		return sess.RespondError(req.ReqID, "Webhook not found", nil)
+	}
+
+	if ok, err := h.requireChannelOp(sess, req.ReqID, webhook.ChannelID, "revoke webhooks"); !ok {
+		return err
+	}
+
+	if err := models.DeleteWebhook(h.db, webhook.ID); err != nil {
+		return sess.RespondError(req.ReqID, "Failed to revoke webhook", err)
+	}
+
+	req.Logger(sess).Info("User revoked webhook",
+		"nickname", *sess.Nickname, "channel_id", webhook.ChannelID, "webhook_id", webhook.ID)
+
+	return sess.RespondSuccess(req.ReqID, WSRevokeWebhookResponse{
+		WebhookID: webhook.ID,
+		ChannelID: webhook.ChannelID,
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !embed_web
+
+package web
+
+import "io/fs"
+
+// Dist returns the built web client, or nil if the binary was built without
+// it
+func Dist() fs.FS {
+	return nil
+}
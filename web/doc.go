@@ -0,0 +1,3 @@
+// Package web holds the SolidJS web client. Building with the embed_web tag
+// embeds its production build (web/dist, see "make build") into the server.
+package web
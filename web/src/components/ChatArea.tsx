@@ -123,10 +123,15 @@ export function ChatArea() {
     }
   };
 
-  const formatMessage = (message: string) => {
+  const formatMessage = (message: Message) => {
+    // The server renders and sanitizes messages, marked only covers
+    // messages from servers that didn't
+    if (message.html !== undefined) {
+      return message.html;
+    }
     try {
       // Use marked for full markdown support
-      const html = marked.parse(message, { async: false }) as string;
+      const html = marked.parse(message.message, { async: false }) as string;
       // Basic sanitization - remove script tags and on* attributes
       return html
         .replace(/<script[^>]*>.*?<\/script>/gi, "")
@@ -135,7 +140,7 @@ export function ChatArea() {
     } catch (error) {
       console.error("Failed to parse markdown:", error);
       // Fallback to simple text
-      return message;
+      return message.message;
     }
   };
 
@@ -259,7 +264,7 @@ export function ChatArea() {
                       }
                     >
                       <div
-                        innerHTML={formatMessage(message.message)}
+                        innerHTML={formatMessage(message)}
                         class="prose prose-sm prose-invert max-w-none"
                       />
                     </Show>
@@ -74,7 +74,8 @@ export function MessageInput() {
 
         case "kick":
           const username = args[0];
-          const reason = args.slice(1).join(" ");
+          // The reason as typed, after the username
+          const reason = rawArgs.slice(username.length).replace(/^\s+/, "");
           // Find user by nickname in current channel
           const channelUsers = getters.getCurrentChannelUsers();
           const userToKick = channelUsers.find((u) => u.nickname === username);
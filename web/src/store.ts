@@ -172,6 +172,7 @@ function handleChatMessage(message: ChatMessage) {
       user_id: message.user_id,
       nickname: message.nickname,
       message: message.message,
+      html: message.html,
       is_passive: message.is_passive,
       event: "message",
       sent_at: message.sent_at,
@@ -267,6 +268,13 @@ function handleChatEvent(event: ChatEvent) {
       }
       break;
 
+    case "op":
+    case "deop":
+      if (channelId) {
+        refreshChannelUsers(channelId);
+      }
+      break;
+
     case "topic_change":
       if (channelId && event.topic !== undefined) {
         // Ensure channel exists in store before setting topic
@@ -286,15 +294,24 @@ function formatEventMessage(event: ChatEvent): string {
     case "joined":
       return `${event.nickname} joined the channel`;
     case "left":
-      return `${event.nickname} left the channel`;
+      return `${event.nickname} left the channel${event.reason ? ` (${event.reason})` : ""}`;
     case "nick_change":
-      return `${event.old_nickname} is now known as ${event.new_nickname}`;
+      // Nick changes from older servers don't say what the old nickname was
+      return event.old_nickname
+        ? `${event.old_nickname} is now known as ${event.new_nickname}`
+        : `${event.nickname} changed nickname`;
     case "kicked":
-      return `${event.nickname} was kicked${event.kicked_by ? ` by ${event.kicked_by}` : ""}${event.reason ? `: ${event.reason}` : ""}`;
+      return `${event.nickname} was kicked${event.actor_nickname ? ` by ${event.actor_nickname}` : ""}${event.reason ? `: ${event.reason}` : ""}`;
     case "topic_change":
-      return `Topic changed to: ${event.topic}`;
+      return event.topic
+        ? `Topic changed to: ${event.topic}`
+        : "Topic cleared";
     case "announcement":
       return event.message || "Server announcement";
+    case "op":
+      return `${event.actor_nickname || "Server"} gave operator status to ${event.nickname}`;
+    case "deop":
+      return `${event.actor_nickname || "Server"} removed operator status from ${event.nickname}`;
     default:
       return `Unknown event: ${event.event}`;
   }
@@ -327,12 +344,28 @@ wsClient.onConnectionChange = (state: ConnectionState) => {
     });
   }
 
-  // Attempt session restoration on successful connection
+  // Negotiate the protocol, then attempt session restoration on successful connection
   if (state === "connected") {
-    attemptSessionRestoration();
+    negotiateCapabilities().then(attemptSessionRestoration);
   }
 };
 
+// Capabilities the UI makes use of: rendered messages and event details
+const CAPABILITIES = ["rendered-text", "event-details"];
+
+async function negotiateCapabilities() {
+  try {
+    await wsClient.send<any>({
+      cmd: "hello",
+      req_id: "",
+      version: 1,
+      capabilities: CAPABILITIES,
+    });
+  } catch (error) {
+    console.warn("Protocol negotiation failed:", error);
+  }
+}
+
 // Attempt to restore session after connection
 async function attemptSessionRestoration() {
   const sessionId = wsClient.getSessionId();
@@ -424,6 +457,7 @@ async function attemptSessionRestoration() {
                         user_id: msg.user_id,
                         nickname: msg.nickname,
                         message: msg.message,
+                        html: msg.html,
                         is_passive: msg.is_passive,
                         event: "message",
                         sent_at: msg.sent_at,
@@ -799,6 +833,7 @@ export const chatAPI = {
             user_id: msg.user_id,
             nickname: msg.nickname,
             message: msg.message,
+            html: msg.html,
             is_passive: msg.is_passive,
             event: "message",
             sent_at: msg.sent_at,
@@ -71,6 +71,12 @@ export interface AnnounceRequest extends BaseRequest {
   message: string;
 }
 
+export interface HelloRequest extends BaseRequest {
+  cmd: "hello";
+  version: number;
+  capabilities: string[];
+}
+
 export interface HeartbeatRequest extends BaseRequest {
   cmd: "heartbeat";
 }
@@ -117,6 +123,7 @@ export type WebSocketRequest =
   | TopicRequest
   | MeRequest
   | AnnounceRequest
+  | HelloRequest
   | HeartbeatRequest
   | SessionInfoRequest
   | ListChannelsRequest
@@ -174,6 +181,8 @@ export interface ChatMessage {
   user_id: string;
   nickname: string;
   message: string;
+  html?: string; // sanitized rendering of message
+  plain?: string;
   is_passive: boolean;
   sent_at: string;
 }
@@ -187,7 +196,9 @@ export interface ChatEvent {
     | "announcement"
     | "nick_change"
     | "kicked"
-    | "topic_change";
+    | "topic_change"
+    | "op"
+    | "deop";
   user_id?: string;
   nickname?: string;
   sent_at: string;
@@ -195,8 +206,9 @@ export interface ChatEvent {
   old_nickname?: string;
   new_nickname?: string;
   topic?: string;
-  kicked_by?: string;
-  reason?: string;
+  reason?: string; // left and kicked events
+  actor_id?: string; // who kicked, or who granted or revoked op
+  actor_nickname?: string;
 }
 
 export type WebSocketMessage = WebSocketResponse | ChatMessage | ChatEvent;
@@ -206,12 +218,14 @@ export interface User {
   id: string;
   nickname: string;
   is_serv: boolean;
+  is_bot?: boolean;
 }
 
 export interface ChannelUser {
   id: number;
   nickname: string;
   is_serv: boolean;
+  is_bot?: boolean;
   is_op: boolean;
 }
 
@@ -234,6 +248,7 @@ export interface Message {
   user_id: string;
   nickname: string;
   message: string;
+  html?: string; // sanitized rendering of message, from the server
   is_passive: boolean;
   event: string;
   sent_at: string;
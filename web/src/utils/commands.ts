@@ -122,7 +122,8 @@ export function parseCommand(message: string): ParsedCommand | null {
   const parts = withoutSlash.split(/\s+/);
   const command = parts[0].toLowerCase();
   const args = parts.slice(1);
-  const rawArgs = args.join(" ");
+  // The arguments as typed, whitespace and all
+  const rawArgs = withoutSlash.slice(parts[0].length).replace(/^\s+/, "");
 
   // Check if command exists
   const commandDef = IRC_COMMANDS[command];